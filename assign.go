@@ -0,0 +1,133 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrKeyInUse возвращается Assign, если ключ уже выдан другому устройству и еще действует. Эту же
+// ошибку возвращает Put общего хранилища, если ключ успел выдать другой экземпляр сервиса.
+var ErrKeyInUse = errors.New("pairing: ключ уже используется другим устройством")
+
+// Assign сохраняет для устройства заданный ключ вместо сгенерированного, например, при переносе
+// уже выданных ключей из другой системы. Ключ нормализуется так же, как при проверке, и
+// сохраняется с временем жизни Expire или заданным WithExpireFunc для его длины, заменяя уже
+// выданные устройству ключи, а в режиме WithMultiKey — добавляясь к ним. Ключ не обязан состоять
+// из символов словаря, но если задана опция WithChecksum, то он должен содержать правильный
+// контрольный символ.
+//
+// Если ключ уже выдан другому устройству и еще действует, зарезервирован или недавно использован,
+// то возвращается ErrKeyInUse. Повторное назначение того же ключа тому же устройству отсчитывает
+// время его жизни заново. Идентификатор устройства проверяется так же, как в GenerateE, а
+// ограничение MaxActive учитывается так же, как при генерации.
+func (p *Pairs) Assign(deviceID, key string) error {
+	if err := p.checkDeviceID(deviceID); err != nil {
+		return err
+	}
+	key = p.canonical(key)
+	if key == "" {
+		return errors.New("pairing: пустой ключ")
+	}
+	if err := p.checkKey(key); err != nil {
+		return err
+	}
+	var expired []StoreRecord
+	p.mu.Lock()
+	err := p.assign(deviceID, key, &expired)
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return err
+}
+
+// keyLength возвращает длину нормализованного ключа без префикса и контрольного символа.
+func (p *Pairs) keyLength(key string) uint8 {
+	n := utf8.RuneCountInString(strings.TrimPrefix(key, p.canonicalPrefix()))
+	if p.checksum && n > 0 {
+		n--
+	}
+	if n > math.MaxUint8 {
+		n = math.MaxUint8
+	}
+	return uint8(n)
+}
+
+// assign сохраняет нормализованный, но еще не хешированный ключ для устройства. Должна вызываться
+// под блокировкой. Удаленные устаревшие ключи добавляются в expired.
+func (p *Pairs) assign(deviceID, key string, expired *[]StoreRecord) error {
+	if p.closed {
+		return ErrClosed
+	}
+	p.init()
+	if _, ok := p.reserved[key]; ok {
+		return ErrKeyInUse
+	}
+	plain, key := key, p.storeKey(p.scoped(deviceID, key))
+	if _, ok := p.redemption(key); ok {
+		return ErrKeyInUse
+	}
+	current, hasCurrent, err := p.storeByKey(key)
+	if err != nil {
+		return fmt.Errorf("pairing: ошибка чтения хранилища: %w", err)
+	}
+	if hasCurrent && !p.dead(current) && current.DeviceID != deviceID {
+		return ErrKeyInUse
+	}
+	var (
+		old    StoreRecord
+		hasOld bool
+	)
+	if !p.multi {
+		if old, hasOld, err = p.storeByDevice(deviceID); err != nil {
+			return fmt.Errorf("pairing: ошибка чтения хранилища: %w", err)
+		}
+	}
+	oldLive := hasOld && !p.expired(old)
+	if p.MaxActive > 0 {
+		count := p.live()
+		if oldLive || hasCurrent && !p.expired(current) {
+			count-- // ключ этого устройства будет заменен
+		}
+		if count >= p.MaxActive {
+			return ErrTooManyKeys
+		}
+	}
+	if hasCurrent {
+		// запись о ключе удаляется отдельно, так как в режиме нескольких ключей Add ее не заменяет
+		p.store.DeleteByKey(key)
+		if p.expired(current) {
+			*expired = append(*expired, current)
+			p.stats.expired.Add(1)
+		}
+		if hasOld && old.Key == key {
+			hasOld = false // устаревший ключ устройства уже учтен
+		}
+	}
+	now := p.clock()
+	kInfo := StoreRecord{
+		DeviceID: deviceID,
+		Key:      key,
+		Time:     now,
+		Expires:  now.Add(p.lifetime(p.keyLength(plain)) + p.jitter()),
+	}
+	if p.multi {
+		err = p.store.(multiKeyStore).Add(kInfo)
+	} else {
+		err = p.store.Put(kInfo)
+	}
+	if errors.Is(err, ErrKeyInUse) {
+		return ErrKeyInUse // ключ успел выдать другой экземпляр сервиса
+	}
+	if err != nil {
+		return fmt.Errorf("pairing: ошибка сохранения ключа: %w", err)
+	}
+	p.schedule(kInfo)
+	if hasOld && !oldLive {
+		*expired = append(*expired, old)
+		p.stats.expired.Add(1)
+	}
+	p.emit(EventGenerated, deviceID, p.format(plain))
+	return nil
+}
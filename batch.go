@@ -0,0 +1,115 @@
+package pairing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrDuplicateDevice возвращается GenerateBatch, если идентификатор устройства повторяется в
+// списке. Возвращаемая ошибка содержит этот идентификатор.
+var ErrDuplicateDevice = errors.New("pairing: повторяющийся идентификатор устройства")
+
+// BatchError описывает ошибку пакетной генерации ключей и содержит ошибки для каждого из
+// устройств, для которых не удалось сгенерировать ключ.
+type BatchError struct {
+	Failed map[string]error // ошибки генерации по идентификаторам устройств
+}
+
+// Error возвращает описание ошибки со списком устройств, для которых ключ не был сгенерирован.
+func (e *BatchError) Error() string {
+	ids := make([]string, 0, len(e.Failed))
+	for deviceID := range e.Failed {
+		ids = append(ids, deviceID)
+	}
+	sort.Strings(ids)
+	return fmt.Sprintf("pairing: не удалось сгенерировать ключи для %d устройств: %s",
+		len(ids), strings.Join(ids, ", "))
+}
+
+// GenerateBatch генерирует новые ключи сразу для нескольких устройств под одной блокировкой и
+// возвращает их в виде справочника ключей по идентификаторам устройств. Сгенерированные ключи
+// уникальны как между собой, так и по отношению к уже существующим ключам.
+//
+// Если для некоторых устройств ключ сгенерировать не удалось, то генерация для остальных
+// устройств продолжается, а вместе со справочником успешно сгенерированных ключей возвращается
+// ошибка *BatchError с описанием причин для каждого из устройств. Идентификаторы устройств
+// проверяются так же, как в GenerateE.
+//
+// Если идентификатор устройства встречается в списке несколько раз, то ключи не генерируются
+// вовсе и возвращается ошибка ErrDuplicateDevice с первым повторившимся идентификатором, так как
+// второй ключ заменил бы первый. С опцией WithBatchDedup повторы вместо этого пропускаются.
+func (p *Pairs) GenerateBatch(deviceIDs []string) (map[string]string, error) {
+	var (
+		keys    = make(map[string]string, len(deviceIDs))
+		failed  map[string]error
+		expired []StoreRecord
+		seen    = make(map[string]bool, len(deviceIDs))
+		unique  = make([]string, 0, len(deviceIDs))
+	)
+	for _, deviceID := range deviceIDs {
+		if seen[deviceID] {
+			if p.batchDedup {
+				continue // сохраняем первое вхождение
+			}
+			return nil, fmt.Errorf("%w: %q", ErrDuplicateDevice, deviceID)
+		}
+		seen[deviceID] = true
+		unique = append(unique, deviceID)
+	}
+	p.mu.Lock()
+	for _, deviceID := range unique {
+		err := p.checkDeviceID(deviceID)
+		var key string
+		if err == nil {
+			key, err = p.generate(context.Background(), deviceID, true, 0, 0, &expired)
+		}
+		if err != nil {
+			if failed == nil {
+				failed = make(map[string]error)
+			}
+			failed[deviceID] = err
+			continue
+		}
+		keys[deviceID] = key
+	}
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	if failed != nil {
+		return keys, &BatchError{Failed: failed}
+	}
+	return keys, nil
+}
+
+// GenerateN генерирует n ключей для устройств с идентификаторами вида prefix-0 ... prefix-(n-1)
+// под одной блокировкой и возвращает их в порядке номеров устройств. Предназначена для нагрузочных
+// тестов и заполнения хранилища заранее.
+//
+// Если очередной уникальный ключ сгенерировать не удалось, то генерация прекращается и вместе с
+// уже сгенерированными ключами возвращается ошибка.
+func (p *Pairs) GenerateN(deviceIDPrefix string, n int) ([]string, error) {
+	if n < 0 {
+		return nil, errors.New("pairing: количество ключей не может быть отрицательным")
+	}
+	var (
+		keys    = make([]string, 0, n)
+		expired []StoreRecord
+		err     error
+	)
+	p.mu.Lock()
+	for i := 0; i < n; i++ {
+		var key string
+		deviceID := deviceIDPrefix + "-" + strconv.Itoa(i)
+		if key, err = p.generate(context.Background(), deviceID, true, 0, 0, &expired); err != nil {
+			err = fmt.Errorf("pairing: сгенерировано %d ключей из %d: %w", i, n, err)
+			break
+		}
+		keys = append(keys, key)
+	}
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return keys, err
+}
@@ -0,0 +1,87 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGenerateBatch(t *testing.T) {
+	p := mustNew(t)
+	existing := p.Generate("existing")
+	ids := make([]string, 100)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	keys, err := p.GenerateBatch(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unique := map[string]bool{existing: true}
+	for _, deviceID := range ids {
+		key := keys[deviceID]
+		if unique[key] {
+			t.Fatalf("duplicate key %q", key)
+		}
+		unique[key] = true
+		if id, ok := p.Peek(key); !ok || id != deviceID {
+			t.Errorf("bad device for %q: %q", key, id)
+		}
+	}
+}
+
+func TestGenerateBatchPartial(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNumber), WithLength(1), WithMaxIter(200))
+	ids := make([]string, 12)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	keys, err := p.GenerateBatch(ids)
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 10 || len(batchErr.Failed) != 2 {
+		t.Errorf("bad result: %d keys, %d failed", len(keys), len(batchErr.Failed))
+	}
+	for deviceID, err := range batchErr.Failed {
+		if _, ok := keys[deviceID]; ok || !errors.Is(err, ErrKeySpaceExhausted) {
+			t.Errorf("bad failure for %q: %v", deviceID, err)
+		}
+	}
+}
+
+func TestGenerateN(t *testing.T) {
+	p := mustNew(t)
+	keys, err := p.GenerateN("load", 50)
+	if err != nil || len(keys) != 50 {
+		t.Fatalf("unexpected result: %d %v", len(keys), err)
+	}
+	for i, key := range keys {
+		if id, ok := p.Peek(key); !ok || id != fmt.Sprintf("load-%d", i) {
+			t.Errorf("bad device for %q: %q", key, id)
+		}
+	}
+	p = mustNew(t, WithDictionary(DictNum), WithLength(1))
+	keys, err = p.GenerateN("load", 11)
+	if !errors.Is(err, ErrKeySpaceExhausted) || len(keys) != 10 {
+		t.Errorf("unexpected result: %d %v", len(keys), err)
+	}
+}
+
+func TestGenerateBatchDuplicate(t *testing.T) {
+	p := mustNew(t)
+	keys, err := p.GenerateBatch([]string{"a", "b", "a"})
+	if !errors.Is(err, ErrDuplicateDevice) || !strings.Contains(err.Error(), `"a"`) || keys != nil {
+		t.Errorf("unexpected result: %v %v", keys, err)
+	}
+	if p.Len() != 0 {
+		t.Error("keys generated for batch with duplicates")
+	}
+	p = mustNew(t, WithBatchDedup())
+	keys, err = p.GenerateBatch([]string{"a", "b", "a"})
+	if err != nil || len(keys) != 2 || p.Len() != 2 {
+		t.Errorf("unexpected result: %v %v", keys, err)
+	}
+}
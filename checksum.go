@@ -0,0 +1,69 @@
+package pairing
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrBadChecksum возвращается, если контрольный символ ключа не совпадает с вычисленным, т.е.
+// ключ введен с ошибкой.
+var ErrBadChecksum = errors.New("pairing: неверный контрольный символ ключа")
+
+// CheckKey проверяет контрольный символ ключа, если задана опция WithChecksum, не обращаясь к
+// хранилищу. Возвращает ErrBadChecksum, если ключ введен с ошибкой. Проверка не гарантирует, что
+// такой ключ был выдан.
+func (p *Pairs) CheckKey(key string) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.checkKey(p.canonical(key))
+}
+
+// checkKey проверяет контрольный символ ключа, уже приведенного к каноническому виду.
+func (p *Pairs) checkKey(key string) error {
+	if !p.checksum {
+		return nil
+	}
+	runes := []rune(strings.TrimPrefix(key, p.canonicalPrefix()))
+	if len(runes) < 2 {
+		return ErrBadChecksum
+	}
+	check, ok := luhn(p.checkDictionary(), runes[:len(runes)-1])
+	if !ok || check != runes[len(runes)-1] {
+		return ErrBadChecksum
+	}
+	return nil
+}
+
+// checkDictionary возвращает символы словаря в том виде, в котором они используются в
+// канонических ключах.
+func (p *Pairs) checkDictionary() []rune {
+	if p.caseless {
+		return []rune(strings.ToUpper(string(p.Dictionary)))
+	}
+	return []rune(string(p.Dictionary))
+}
+
+// luhn вычисляет контрольный символ для набора символов словаря по алгоритму Луна для основания,
+// равного размеру словаря. Такой символ позволяет обнаружить любую ошибку в одном символе и
+// большинство перестановок соседних символов. Возвращает false, если какой-либо из символов не
+// входит в словарь.
+func luhn(dict []rune, code []rune) (check rune, ok bool) {
+	n := len(dict)
+	factor, sum := 2, 0
+	for i := len(code) - 1; i >= 0; i-- {
+		index := -1
+		for j, r := range dict {
+			if r == code[i] {
+				index = j
+				break
+			}
+		}
+		if index < 0 {
+			return 0, false
+		}
+		addend := factor * index
+		sum += addend/n + addend%n
+		factor = 3 - factor // множители 2 и 1 чередуются
+	}
+	return dict[(n-sum%n)%n], true
+}
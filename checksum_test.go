@@ -0,0 +1,52 @@
+package pairing
+
+import "testing"
+
+func TestWithChecksum(t *testing.T) {
+	p := mustNew(t, WithChecksum(), WithDictionary(DictNumber), WithLength(5), WithPrefix("X"))
+	key := p.Generate("device")
+	if len(key) != 7 || p.CheckKey(key) != nil {
+		t.Fatalf("bad key %q", key)
+	}
+	// замена любого символа должна обнаруживаться
+	for i := 1; i < len(key); i++ {
+		for c := byte('0'); c <= '9'; c++ {
+			if c == key[i] {
+				continue
+			}
+			typo := key[:i] + string(c) + key[i+1:]
+			if err := p.CheckKey(typo); err != ErrBadChecksum {
+				t.Fatalf("typo %q not detected: %v", typo, err)
+			}
+		}
+	}
+	typo := key[:len(key)-1] + string('0'+(key[len(key)-1]-'0'+1)%10)
+	if _, ok := p.Peek(typo); ok {
+		t.Error("bad key found")
+	}
+	if _, status := p.Lookup(typo); status != BadChecksum {
+		t.Errorf("unexpected status %v", status)
+	}
+	if p.GetDeviceID(key) != "device" {
+		t.Error("key not found")
+	}
+}
+
+func TestChecksumForeignKey(t *testing.T) {
+	p := mustNew(t, WithChecksum(), WithDictionary(DictNumber),
+		WithKeyFunc(func(length uint8) string { return "12AB3" }))
+	if key, err := p.GenerateE("device"); err == nil {
+		t.Errorf("key with foreign characters generated: %q", key)
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	// для цифр алгоритм совпадает с классическим алгоритмом Луна
+	check, ok := luhn([]rune(DictNumber), []rune("7992739871"))
+	if !ok || check != '3' {
+		t.Errorf("unexpected check %q", check)
+	}
+	if _, ok := luhn([]rune(DictNumber), []rune("12A")); ok {
+		t.Error("unknown char accepted")
+	}
+}
@@ -0,0 +1,30 @@
+package pairing
+
+import "time"
+
+// SyncedClock возвращает функцию текущего времени для WithClock, синхронизированную с временем
+// сервера. serverNow — время сервера, полученное непосредственно перед вызовом, например, от
+// общего хранилища ключей. Возвращаемая функция добавляет к локальному времени разницу между
+// временем сервера и локальным временем на момент вызова, поэтому экземпляры сервиса с
+// расходящимися часами одинаково определяют срок действия ключей. Задержка получения времени
+// сервера не учитывается. Так как локальные часы могут уходить, синхронизацию следует периодически
+// повторять, создавая новый список или используя функцию, которая сама обновляет смещение.
+func SyncedClock(serverNow time.Time) func() time.Time {
+	offset := time.Until(serverNow)
+	return func() time.Time {
+		return time.Now().Add(offset)
+	}
+}
+
+// ExpiresFrom возвращает время окончания действия ключа длины Length, выданного в момент issuedAt
+// по часам сервера, с временем жизни новых ключей, заданным для этого списка. Позволяет вычислить
+// срок действия ключа по времени, полученному от общего хранилища, а не по локальным часам.
+// Случайная добавка, заданная WithExpireJitter, не учитывается, поэтому возвращается самое
+// раннее возможное время окончания действия.
+func (p *Pairs) ExpiresFrom(issuedAt time.Time) time.Time {
+	p.mu.Lock()
+	p.init()
+	exp := p.lifetime(p.Length)
+	p.mu.Unlock()
+	return issuedAt.Add(exp)
+}
@@ -0,0 +1,60 @@
+package pairing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyncedClock(t *testing.T) {
+	server := time.Now().Add(time.Hour) // часы сервера опережают локальные
+	now := SyncedClock(server)()
+	if d := now.Sub(server); d < 0 || d > time.Second {
+		t.Errorf("clock not synced: %v", d)
+	}
+	p := mustNew(t, WithClock(SyncedClock(server)), WithExpire(time.Minute))
+	key, issued, expires := p.GenerateInfo("device")
+	if issued.Before(server) || !expires.Equal(p.ExpiresFrom(issued)) {
+		t.Errorf("unexpected times: %v %v", issued, expires)
+	}
+	if _, ok := p.Peek(key); !ok {
+		t.Error("key not found")
+	}
+}
+
+func TestClockMonotonic(t *testing.T) {
+	var jump time.Duration
+	// время возвращается вместе с показаниями монотонных часов
+	p := mustNew(t, WithExpire(time.Hour), WithClock(func() time.Time { return time.Now().Add(jump) }))
+	key, issued, expires := p.GenerateInfo("device")
+	for _, tm := range []time.Time{issued, expires} {
+		if strings.Contains(tm.String(), "m=") {
+			t.Errorf("monotonic clock reading stored: %v", tm)
+		}
+	}
+	// большой скачок часов, например, после приостановки системы
+	jump = 2 * time.Hour
+	if _, ok := p.TTL(key); ok {
+		t.Error("key not expired after clock jump")
+	}
+	if _, status := p.Lookup(key); status != Expired {
+		t.Errorf("unexpected status: %v", status)
+	}
+}
+
+func TestClockJump(t *testing.T) {
+	var offset time.Duration
+	// обычные часы сдвигаются на offset, а монотонные продолжают идти равномерно
+	p := mustNew(t, WithExpire(time.Hour), WithClock(func() time.Time { return time.Now().Add(offset) }))
+	key := p.Generate("device")
+	// скачок назад продлевает действие ключа, т.к. срок отсчитывается по обычным часам
+	offset = -2 * time.Hour
+	if ttl, ok := p.TTL(key); !ok || ttl < 3*time.Hour-time.Second || ttl > 3*time.Hour {
+		t.Errorf("unexpected ttl after backward jump: %v", ttl)
+	}
+	// скачок вперед сразу завершает его действие
+	offset = 2 * time.Hour
+	if ttl, ok := p.TTL(key); ok {
+		t.Errorf("key not expired after forward jump: %v", ttl)
+	}
+}
@@ -0,0 +1,112 @@
+package pairing
+
+import "time"
+
+// Clone возвращает независимую копию списка ключей на текущий момент, например, для передачи в
+// реплику только для чтения или для построения отчетов. Копия создается под блокировкой только
+// на чтение, поэтому она согласована, а генерация и использование ключей в исходном списке на
+// время копирования приостанавливаются, но проверки ключей — нет.
+//
+// Копия использует те же параметры, но все записи о ключах, включая еще не удаленные устаревшие,
+// копируются в новое хранилище в памяти, даже если исходный список использует хранилище,
+// заданное WithStore. Поэтому изменение копии не влияет на исходный список и наоборот, но на время
+// существования копии занимаемая ключами память удваивается. Накопленная статистика, канал
+// событий и процессы очистки не копируются, а источник случайных данных, заданный
+// WithRandSource, заменяется источником по умолчанию, т.к. он не может использоваться
+// одновременно двумя списками.
+func (p *Pairs) Clone() *Pairs {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	size := p.initialCapacity()
+	if counter, ok := p.store.(interface{ Len() int }); ok {
+		size = counter.Len()
+	}
+	store := newMemStore(size)
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		store.Add(kInfo) // записи передаются по значению, поэтому копии независимы
+		return true
+	})
+	// параметры копируются по одному, т.к. Pairs содержит блокировку и атомарные счетчики; новые
+	// параметры Pairs нужно добавлять и сюда
+	c := &Pairs{
+		Dictionary:   p.Dictionary,
+		Length:       p.Length,
+		Expire:       p.Expire,
+		MaxIter:      p.MaxIter,
+		MaxActive:    p.MaxActive,
+		OnExpire:     p.OnExpire,
+		OnConsume:    p.OnConsume,
+		store:        store,
+		groupSize:    p.groupSize,
+		groupSep:     p.groupSep,
+		caseless:     p.caseless,
+		reuse:        p.reuse,
+		minEntropy:   p.minEntropy,
+		shards:       p.shards,
+		shard:        p.shard,
+		now:          p.now,
+		mask:         p.mask,
+		maskVisible:  p.maskVisible,
+		maxDeviceID:  p.maxDeviceID,
+		capacity:     p.capacity,
+		maxFill:      p.maxFill,
+		compactRatio: p.compactRatio,
+		warnFill:     p.warnFill,
+		onFill:       p.onFill,
+		logger:       p.logger,
+		blocklist:    p.blocklist,
+		minDistinct:  p.minDistinct,
+		collisionKey: p.collisionKey,
+		stripChars:   p.stripChars,
+		cooldown:     p.cooldown,
+		outputCase:   p.outputCase,
+		perDevice:    p.perDevice,
+		noRotate:     p.noRotate,
+		batchDedup:   p.batchDedup,
+		multi:        p.multi,
+		prefix:       p.prefix,
+		checksum:     p.checksum,
+		hashed:       p.hashed,
+		hashSecret:   p.hashSecret,
+		reservedKeys: p.reservedKeys,
+		reserved:     p.reserved, // после инициализации справочник не изменяется
+		segments:     p.segments,
+		keyFunc:      p.keyFunc,
+		expireFunc:   p.expireFunc,
+		autoWiden:    p.autoWiden,
+		lengthLimit:  p.lengthLimit,
+		grace:        p.grace,
+		redeemed:     p.redeemed.clone(),
+		genWindow:    p.genWindow,
+		expireJitter: p.expireJitter,
+		softGrace:    p.softGrace,
+		generations:  p.generations.clone(),
+		closed:       p.closed,
+	}
+	c.init()
+	return c
+}
+
+// clone возвращает независимую копию недавно использованных ключей.
+func (r redemptions) clone() redemptions {
+	if r.keys == nil {
+		return r
+	}
+	keys := make(map[string]StoreRecord, len(r.keys))
+	for key, kInfo := range r.keys {
+		keys[key] = kInfo
+	}
+	return redemptions{keys: keys, pruneAt: r.pruneAt}
+}
+
+// clone возвращает независимую копию моментов генерации ключей.
+func (g genCounts) clone() genCounts {
+	if g.devices == nil {
+		return g
+	}
+	devices := make(map[string][]time.Time, len(g.devices))
+	for deviceID, times := range g.devices {
+		devices[deviceID] = append([]time.Time(nil), times...)
+	}
+	return genCounts{devices: devices, pruneAt: g.pruneAt}
+}
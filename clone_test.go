@@ -0,0 +1,50 @@
+package pairing
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClone(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithGrouping(3, "-"),
+		WithRedeemGrace(time.Minute))
+	key := p.Generate("device")
+	used := p.Generate("used")
+	p.GetDeviceID(used)
+	c := p.Clone()
+	if c.Config() != p.Config() {
+		t.Errorf("config not copied: %+v", c.Config())
+	}
+	if id := c.GetDeviceID(key); id != "device" {
+		t.Errorf("key not copied: %q", id)
+	}
+	if _, ok := p.Peek(key); !ok {
+		t.Error("original changed by clone")
+	}
+	if _, status := c.Lookup(used); status != Redeemed {
+		t.Errorf("redeemed key not copied: %v", status)
+	}
+	other := p.Generate("other")
+	if _, ok := c.Peek(other); ok {
+		t.Error("clone changed by original")
+	}
+	// копирование не мешает одновременной работе с исходным списком
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			p.Generate(strconv.Itoa(i))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		p.Clone()
+	}
+	wg.Wait()
+	if c := p.Clone(); c.Len() != p.Len() {
+		t.Errorf("unexpected clone length: %d", c.Len())
+	}
+}
@@ -0,0 +1,84 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Config описывает действующие параметры генерации ключей с учетом значений по умолчанию.
+type Config struct {
+	Dictionary Dictionary    // словарь символов ключа
+	Length     uint8         // длина новых ключей
+	MaxLength  uint8         // максимальная длина ключа с учетом WithAutoWiden
+	Expire     time.Duration // время жизни новых ключей
+	MaxIter    uint16        // количество попыток генерации ключа каждой длины
+	MaxActive  int           // максимальное количество действующих ключей или 0
+	Prefix     string        // префикс ключа
+	GroupSize  int           // количество символов в группе или 0, если ключ не разбивается
+	GroupSep   string        // разделитель групп символов
+	Checksum   bool          // к ключу добавляется контрольный символ
+	Caseless   bool          // регистр введенного ключа не учитывается
+	MultiKey   bool          // устройству можно выдать несколько ключей
+}
+
+// Config возвращает параметры, которые будут использоваться при генерации ключей, с уже
+// подставленными значениями по умолчанию. Состояние списка при этом не изменяется, поэтому
+// функцию можно вызывать и до первой генерации ключа.
+func (p *Pairs) Config() Config {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	c := Config{
+		Dictionary: p.Dictionary,
+		Length:     p.Length,
+		Expire:     p.Expire,
+		MaxIter:    p.MaxIter,
+		MaxActive:  p.MaxActive,
+		Prefix:     p.prefix,
+		GroupSize:  p.groupSize,
+		GroupSep:   p.groupSep,
+		Checksum:   p.checksum,
+		Caseless:   p.caseless,
+		MultiKey:   p.multi,
+	}
+	if len(c.Dictionary) == 0 {
+		c.Dictionary = DictAlfa
+	}
+	if c.Length == 0 {
+		c.Length = defaultLength
+	}
+	if c.Expire == 0 {
+		c.Expire = defaultExpire
+	}
+	if c.MaxIter == 0 {
+		c.MaxIter = defaultMaxIter
+	}
+	if c.GroupSize <= 0 || c.GroupSep == "" {
+		c.GroupSize, c.GroupSep = 0, "" // ключ не разбивается на группы
+	}
+	c.MaxLength = p.maxLengthOf(c.Length)
+	return c
+}
+
+// errNoText возвращается при попытке получить или разобрать текстовое представление Pairs.
+var errNoText = errors.New("pairing: текстовое представление Pairs не поддерживается")
+
+// String возвращает краткое описание действующих параметров генерации ключей. Определена явно,
+// чтобы вместо списка не выводился только встроенный в него словарь.
+func (p *Pairs) String() string {
+	c := p.Config()
+	return fmt.Sprintf("pairing.Pairs{Dictionary: %q, Length: %d, Expire: %v}",
+		c.Dictionary, c.Length, c.Expire)
+}
+
+// MarshalText всегда возвращает ошибку: определена явно, чтобы при сериализации списка вместо
+// него не сохранялся только встроенный словарь. Для сохранения параметров используйте Config.
+func (p *Pairs) MarshalText() ([]byte, error) {
+	return nil, errNoText
+}
+
+// UnmarshalText всегда возвращает ошибку: определена явно, чтобы разбор текста не заменял
+// только встроенный словарь. Словарь задается с помощью WithDictionary.
+func (p *Pairs) UnmarshalText([]byte) error {
+	return errNoText
+}
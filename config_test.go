@@ -0,0 +1,43 @@
+package pairing
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestConfig(t *testing.T) {
+	var p Pairs
+	c := p.Config()
+	if c.Length != defaultLength || c.Expire != defaultExpire || c.MaxIter != defaultMaxIter ||
+		c.Dictionary != DictAlfa || c.MaxLength != defaultLength {
+		t.Errorf("unexpected defaults: %+v", c)
+	}
+	if p.Length != 0 || p.store != nil {
+		t.Error("config changed state")
+	}
+	q := mustNew(t, WithLength(4), WithAutoWiden(8), WithExpire(time.Minute), WithGrouping(2, "-"))
+	c = q.Config()
+	if c.Length != 4 || c.MaxLength != 8 || c.Expire != time.Minute || c.GroupSize != 2 ||
+		c.GroupSep != "-" {
+		t.Errorf("unexpected config: %+v", c)
+	}
+}
+
+func TestPairsText(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(4), WithExpire(time.Minute))
+	if s := fmt.Sprint(p); s != `pairing.Pairs{Dictionary: "0123456789", Length: 4, Expire: 1m0s}` {
+		t.Errorf("unexpected string: %s", s)
+	}
+	var zero Pairs
+	if s := fmt.Sprint(&zero); s == "" || zero.Length != 0 || zero.store != nil {
+		t.Error("printing changed state")
+	}
+	if data, err := json.Marshal(p); err == nil {
+		t.Errorf("pairs marshaled as %s", data)
+	}
+	if err := json.Unmarshal([]byte(`"ABC"`), p); err == nil || p.Dictionary != DictNum {
+		t.Errorf("dictionary replaced: %q %v", p.Dictionary, err)
+	}
+}
@@ -1,33 +1,208 @@
 package pairing
 
 import (
-	"math/rand"
-	"time"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"unicode"
+	"unicode/utf8"
 )
 
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
-
 // Dictionary описывает словарь символов, из которых может генерироваться код для активации.
-// Для простоты я не стал проверять словарь на то, что он содержит юникодные символы, описывающиеся
-// несколькими байтами, поэтому для корректной работы рекомендуется, чтобы в словаре использовались
-// только печатные ASCII символы.
+// Словарь рассматривается как набор символов Unicode, а не байт, поэтому в нем можно
+// использовать и символы, описывающиеся несколькими байтами, например, кириллицу. Длина ключа
+// тоже задается в символах.
 type Dictionary string
 
-// Generate возвращает случайный набор символов из словаря заданной длинны.
+// NewDictionary возвращает словарь, состоящий из указанных символов, предварительно проверив его
+// с помощью Validate.
+func NewDictionary(runes []rune) (Dictionary, error) {
+	d := Dictionary(runes)
+	if err := d.Validate(); err != nil {
+		return "", err
+	}
+	return d, nil
+}
+
+// Len возвращает количество символов в словаре.
+func (d Dictionary) Len() int {
+	return utf8.RuneCountInString(string(d))
+}
+
+// String возвращает символы словаря в виде строки.
+func (d Dictionary) String() string {
+	return string(d)
+}
+
+// MarshalText возвращает символы словаря, что позволяет сохранять его в файлах настроек, например,
+// в формате JSON или YAML. Реализует интерфейс encoding.TextMarshaler.
+func (d Dictionary) MarshalText() ([]byte, error) {
+	return []byte(d), nil
+}
+
+// UnmarshalText устанавливает словарь из символов text, предварительно проверив его с помощью
+// Validate. Реализует интерфейс encoding.TextUnmarshaler.
+func (d *Dictionary) UnmarshalText(text []byte) error {
+	if !utf8.Valid(text) {
+		return errors.New("pairing: словарь содержит недопустимые символы UTF-8")
+	}
+	dict := Dictionary(text)
+	if err := dict.Validate(); err != nil {
+		return err
+	}
+	*d = dict
+	return nil
+}
+
+// ErrEmptyDictionary возвращается при попытке генерации ключа по пустому словарю.
+var ErrEmptyDictionary = errors.New("pairing: пустой словарь")
+
+// Validate проверяет, что словарь не пустой и не содержит повторяющихся символов: повторяющиеся
+// символы выпадали бы чаще остальных и искажали равномерность распределения.
+func (d Dictionary) Validate() error {
+	if len(d) == 0 {
+		return ErrEmptyDictionary
+	}
+	var (
+		seen = make(map[rune]bool, len(d))
+		dups []rune
+	)
+	for _, r := range string(d) {
+		if seen[r] {
+			dups = append(dups, r)
+		}
+		seen[r] = true
+	}
+	if len(dups) > 0 {
+		return fmt.Errorf("pairing: повторяющиеся символы в словаре: %q", string(dups))
+	}
+	return nil
+}
+
+// validateCaseless проверяет, что в словаре нет одних и тех же букв в разных регистрах: без учета
+// регистра такие символы совпадали бы.
+func (d Dictionary) validateCaseless() error {
+	var (
+		seen = make(map[rune]bool, len(d))
+		dups []rune
+	)
+	for _, r := range string(d) {
+		upper := unicode.ToUpper(r)
+		if seen[upper] {
+			dups = append(dups, r)
+		}
+		seen[upper] = true
+	}
+	if len(dups) > 0 {
+		return fmt.Errorf("pairing: символы словаря совпадают без учета регистра: %q", string(dups))
+	}
+	return nil
+}
+
+// Generate возвращает случайный набор символов из словаря заданной длинны. В качестве источника
+// случайных чисел используется crypto/rand. Если получить случайные данные не удалось, то
+// вызывается panic: для обработки ошибки используйте GenerateFrom.
 func (d Dictionary) Generate(length uint8) string {
-	response := make([]byte, length)
-	for i := range response {
-		response[i] = d[rand.Intn(len(d))] // заполняем случайным набором из словаря
+	key, err := d.GenerateFrom(rand.Reader, length)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// GenerateFrom возвращает случайный набор символов из словаря заданной длинны, используя в
+// качестве источника случайных данных src. Символы выбираются равномерно: значения, которые
+// привели бы к смещению распределения при взятии остатка от деления, отбрасываются. Ошибка
+// чтения из источника возвращается без изменений.
+func (d Dictionary) GenerateFrom(src io.Reader, length uint8) (string, error) {
+	return d.GenerateInto(make([]rune, length), src)
+}
+
+// GenerateInto работает так же, как GenerateFrom, но заполняет случайными символами из словаря
+// весь переданный буфер buf и возвращает его содержимое в виде строки. Повторное использование
+// буфера позволяет избежать лишних выделений памяти при многократной генерации.
+func (d Dictionary) GenerateInto(buf []rune, src io.Reader) (string, error) {
+	if err := d.fill(buf, src); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// fill заполняет buf случайными символами из словаря.
+func (d Dictionary) fill(buf []rune, src io.Reader) error {
+	if len(d) == 0 {
+		return ErrEmptyDictionary
+	}
+	if d.isASCII() {
+		// символы словаря можно брать непосредственно из строки без преобразования
+		if err := uniform(src, len(d), buf); err != nil {
+			return err
+		}
+		for i, n := range buf {
+			buf[i] = rune(d[n])
+		}
+		return nil
+	}
+	runes := []rune(string(d))
+	if err := uniform(src, len(runes), buf); err != nil {
+		return err
+	}
+	for i, n := range buf {
+		buf[i] = runes[n] // заполняем случайным набором из словаря
+	}
+	return nil
+}
+
+// isASCII возвращает true, если словарь состоит только из символов ASCII.
+func (d Dictionary) isASCII() bool {
+	for i := 0; i < len(d); i++ {
+		if d[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// uniform заполняет out случайными числами, равномерно распределенными в диапазоне [0, n).
+// Для каждого числа из источника читается столько байт, сколько необходимо для представления n,
+// а значения, не попадающие в диапазон, кратный n, отбрасываются и читаются заново.
+func uniform(src io.Reader, n int, out []rune) error {
+	size := 1 // количество байт на одно число
+	for uint64(n) > 1<<(8*uint(size)) {
+		size++
+	}
+	space := uint64(1) << (8 * uint(size))
+	limit := space - space%uint64(n) // все значения не меньше этого отбрасываются
+	buf := make([]byte, len(out)*size)
+	for filled := 0; filled < len(out); {
+		chunk := buf[:(len(out)-filled)*size]
+		if _, err := io.ReadFull(src, chunk); err != nil {
+			return err
+		}
+		for i := 0; i < len(chunk) && filled < len(out); i += size {
+			var v uint64
+			for _, b := range chunk[i : i+size] {
+				v = v<<8 | uint64(b)
+			}
+			if v >= limit {
+				continue // значение приводит к смещению — пропускаем
+			}
+			out[filled] = rune(v % uint64(n))
+			filled++
+		}
 	}
-	return string(response)
+	return nil
 }
 
 // Предопределенные словари для генерации уникальных кодов активации.
 const (
 	// только цифры
 	DictNumber Dictionary = "0123456789"
+	// только цифры: синоним DictNumber для ввода с цифровой клавиатуры
+	DictNum = DictNumber
 	// цифры и буквы
 	DictAlfa = DictNumber + "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// цифры и буквы без легко путаемых при чтении символов: 0 и O, 1 и I, 5 и S
+	DictUnambiguous Dictionary = "2346789ABCDEFGHJKLMNPQRTUVWXYZ"
 )
@@ -1,7 +1,14 @@
 package pairing
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"testing"
 )
 
@@ -10,3 +17,218 @@ func TestDictionary(t *testing.T) {
 		fmt.Println(DictAlfa.Generate(4))
 	}
 }
+
+func TestDictionaryGenerateFrom(t *testing.T) {
+	// 36 символов: байты 252..255 должны быть отброшены
+	src := bytes.NewReader([]byte{255, 252, 0, 1, 37})
+	key, err := DictAlfa.GenerateFrom(src, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "011" {
+		t.Errorf("unexpected key %q", key)
+	}
+	errRead := errors.New("read error")
+	if _, err := DictAlfa.GenerateFrom(errReader{errRead}, 3); err != errRead {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := Dictionary("").GenerateFrom(strings.NewReader("abc"), 3); err != ErrEmptyDictionary {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDictionaryGenerateInto(t *testing.T) {
+	buf := make([]rune, 3)
+	for _, test := range []struct {
+		dict Dictionary
+		want string
+	}{
+		{DictAlfa, "01B"},
+		{"АБВГДЕЖЗИК", "АББ"}, // 10 символов: байты 250..255 должны быть отброшены
+	} {
+		key, err := test.dict.GenerateInto(buf, bytes.NewReader([]byte{255, 252, 0, 1, 11}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != test.want || string(buf) != test.want {
+			t.Errorf("unexpected key %q, want %q", key, test.want)
+		}
+	}
+}
+
+func BenchmarkDictionaryGenerateFrom(b *testing.B) {
+	src := bufio.NewReader(rand.Reader)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DictAlfa.GenerateFrom(src, 6); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDictionaryGenerateInto(b *testing.B) {
+	src := bufio.NewReader(rand.Reader)
+	buf := make([]rune, 6)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := DictAlfa.GenerateInto(buf, src); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestUniform(t *testing.T) {
+	// каждое значение байта встречается ровно один раз, поэтому после отбрасывания значений,
+	// приводящих к смещению, все числа должны встретиться одинаковое количество раз
+	for _, n := range []int{10, 36, 200} {
+		all := make([]byte, 256)
+		for i := range all {
+			all[i] = byte(i)
+		}
+		count := 256 / n
+		out := make([]rune, n*count)
+		if err := uniform(bytes.NewReader(all), n, out); err != nil {
+			t.Fatal(err)
+		}
+		counts := make([]int, n)
+		for _, v := range out {
+			counts[v]++
+		}
+		for v, c := range counts {
+			if c != count {
+				t.Errorf("n=%d: value %d appears %d times, want %d", n, v, c, count)
+			}
+		}
+	}
+}
+
+func TestGenerateUniform(t *testing.T) {
+	var wide []rune // словарь из 200 символов, размер которого не кратен степени двойки
+	for r := rune(0x100); len(wide) < 200; r++ {
+		wide = append(wide, r)
+	}
+	for _, dict := range []Dictionary{DictAlfa, DictUnambiguous, Dictionary(wide)} {
+		runes := []rune(string(dict))
+		counts := make(map[rune]int, len(runes))
+		const keys, length = 50000, 6
+		for i := 0; i < keys; i++ {
+			for _, r := range dict.Generate(length) {
+				counts[r]++
+			}
+		}
+		// критерий хи-квадрат: при равномерном распределении его значение близко к количеству
+		// степеней свободы, а смещение от взятия остатка дало бы значение в десятки раз больше
+		expected := float64(keys*length) / float64(len(runes))
+		var chi2 float64
+		for _, r := range runes {
+			d := float64(counts[r]) - expected
+			chi2 += d * d / expected
+		}
+		if df := float64(len(runes) - 1); chi2 > df+10*math.Sqrt(2*df) {
+			t.Errorf("%d symbols: chi-square %.1f for %v degrees of freedom", len(runes), chi2, df)
+		}
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestDictNum(t *testing.T) {
+	const samples = 10000
+	var counts [6][10]int // количество цифр в каждой позиции
+	for i := 0; i < samples; i++ {
+		key := DictNum.Generate(6)
+		if len(key) != 6 {
+			t.Fatalf("bad key length: %q", key)
+		}
+		for pos, c := range []byte(key) {
+			if c < '0' || c > '9' {
+				t.Fatalf("not a digit: %q", key)
+			}
+			counts[pos][c-'0']++
+		}
+	}
+	const expected = samples / 10
+	for pos := range counts {
+		for digit, n := range counts[pos] {
+			if n < expected*85/100 || n > expected*115/100 {
+				t.Errorf("position %d, digit %d: %d of %d", pos, digit, n, samples)
+			}
+		}
+	}
+}
+
+func TestDictUnambiguous(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		key := DictUnambiguous.Generate(8)
+		if strings.ContainsAny(key, "0O1Il5S") {
+			t.Fatalf("ambiguous character in %q", key)
+		}
+	}
+}
+
+func TestDictionaryValidate(t *testing.T) {
+	for _, dict := range []Dictionary{DictNumber, DictAlfa, DictUnambiguous} {
+		if err := dict.Validate(); err != nil {
+			t.Errorf("%q: %v", dict, err)
+		}
+	}
+	if err := Dictionary("").Validate(); err != ErrEmptyDictionary {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := Dictionary("ABCAB").Validate()
+	if err == nil || !strings.Contains(err.Error(), `"AB"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewDictionary(t *testing.T) {
+	dict, err := NewDictionary([]rune("АБВГДЕЖЗИКЛМНПРСТУФХЦЧШЭЮЯ"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dict.Len() != 26 {
+		t.Errorf("bad dictionary length: %d", dict.Len())
+	}
+	for i := 0; i < 100; i++ {
+		key := dict.Generate(6)
+		if n := len([]rune(key)); n != 6 {
+			t.Fatalf("bad key length %d: %q", n, key)
+		}
+		for _, r := range key {
+			if !strings.ContainsRune(string(dict), r) {
+				t.Fatalf("unexpected character %q in %q", r, key)
+			}
+		}
+	}
+	if key := Dictionary("🔑🔒").Generate(3); len([]rune(key)) != 3 {
+		t.Errorf("bad emoji key: %q", key)
+	}
+	if _, err := NewDictionary([]rune("ЖЖ")); err == nil {
+		t.Error("duplicate characters accepted")
+	}
+	if _, err := NewDictionary(nil); err != ErrEmptyDictionary {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDictionaryText(t *testing.T) {
+	data, err := json.Marshal(struct{ Dict Dictionary }{DictNum})
+	if err != nil || string(data) != `{"Dict":"0123456789"}` {
+		t.Fatalf("unexpected json: %s %v", data, err)
+	}
+	var config struct{ Dict Dictionary }
+	if err := json.Unmarshal([]byte(`{"Dict":"АБВ"}`), &config); err != nil ||
+		config.Dict != "АБВ" || config.Dict.String() != "АБВ" {
+		t.Errorf("unexpected dictionary: %q %v", config.Dict, err)
+	}
+	for _, text := range []string{`{"Dict":"AA"}`, `{"Dict":""}`} {
+		if err := json.Unmarshal([]byte(text), &config); err == nil {
+			t.Errorf("invalid dictionary accepted: %s", text)
+		}
+	}
+	if err := config.Dict.UnmarshalText([]byte("\xff")); err == nil {
+		t.Error("invalid UTF-8 accepted")
+	}
+}
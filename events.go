@@ -0,0 +1,107 @@
+package pairing
+
+import (
+	"sync"
+	"time"
+)
+
+// eventBuffer задает размер буфера канала событий.
+const eventBuffer = 256
+
+// EventType описывает тип события списка ключей.
+type EventType int
+
+// Типы событий.
+const (
+	EventGenerated EventType = iota + 1 // сгенерирован новый ключ
+	EventConsumed                       // ключ использован с помощью GetDeviceID или Lookup
+	EventExpired                        // ключ удален из-за истечения времени жизни
+	EventRevoked                        // ключ отозван
+)
+
+// String возвращает название типа события.
+func (t EventType) String() string {
+	switch t {
+	case EventGenerated:
+		return "generated"
+	case EventConsumed:
+		return "consumed"
+	case EventExpired:
+		return "expired"
+	case EventRevoked:
+		return "revoked"
+	default:
+		return "unknown"
+	}
+}
+
+// Event описывает событие, связанное с ключом устройства.
+type Event struct {
+	Type     EventType // тип события
+	DeviceID string    // идентификатор устройства
+	Key      string    // ключ
+	Time     time.Time // время события
+}
+
+// eventStream описывает канал событий, который можно закрыть одновременно с отправкой событий.
+type eventStream struct {
+	mu     sync.RWMutex
+	ch     chan Event
+	closed bool // список закрыт, и новые каналы не создаются
+}
+
+// Events возвращает канал, в который отправляются события о генерации, использовании, истечении
+// времени жизни и отзыве ключей. Канал создается при первом вызове, а повторные вызовы
+// возвращают тот же канал.
+//
+// Канал буферизован, и события отправляются в него без ожидания: если буфер заполнен, то событие
+// отбрасывается. Поэтому медленный получатель не блокирует работу с ключами, но может пропустить
+// часть событий. Для закрытия канала используйте StopEvents. После вызова Close возвращается уже
+// закрытый канал.
+func (p *Pairs) Events() <-chan Event {
+	p.events.mu.Lock()
+	defer p.events.mu.Unlock()
+	// флаг проверяется под той же блокировкой, под которой Close закрывает канал, поэтому после
+	// закрытия списка новый канал уже не будет создан
+	if p.events.closed {
+		ch := make(chan Event)
+		close(ch)
+		return ch
+	}
+	if p.events.ch == nil {
+		p.events.ch = make(chan Event, eventBuffer)
+	}
+	return p.events.ch
+}
+
+// StopEvents прекращает отправку событий и закрывает канал, возвращенный Events. Последующий
+// вызов Events создаст новый канал. Повторный вызов ничего не делает.
+func (p *Pairs) StopEvents() {
+	p.stopEvents(false)
+}
+
+// stopEvents закрывает канал событий, а если final установлен, то и запрещает создавать новые.
+func (p *Pairs) stopEvents(final bool) {
+	p.events.mu.Lock()
+	if p.events.ch != nil {
+		close(p.events.ch)
+		p.events.ch = nil
+	}
+	if final {
+		p.events.closed = true
+	}
+	p.events.mu.Unlock()
+}
+
+// emit отправляет событие в канал, если он создан и в нем есть место. Может вызываться как под
+// блокировкой Pairs, так и без нее.
+func (p *Pairs) emit(t EventType, deviceID, key string) {
+	p.events.mu.RLock()
+	if p.events.ch != nil {
+		select {
+		case p.events.ch <- Event{Type: t, DeviceID: deviceID, Key: key, Time: p.clock()}:
+		default: // буфер заполнен — событие отбрасывается
+		}
+	}
+	p.events.mu.RUnlock()
+}
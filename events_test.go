@@ -0,0 +1,76 @@
+package pairing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute))
+	events := p.Events()
+	if p.Events() != events {
+		t.Error("new channel returned")
+	}
+	key := p.Generate("consumed")
+	p.GetDeviceID(key)
+	revoked := p.Generate("revoked")
+	p.Revoke("revoked")
+	expired := p.Generate("expired")
+	clock.Advance(time.Minute)
+	p.GetDeviceID(expired)
+	p.StopEvents()
+	p.StopEvents()
+	want := []Event{
+		{EventGenerated, "consumed", key, clock.now.Add(-time.Minute)},
+		{EventConsumed, "consumed", key, clock.now.Add(-time.Minute)},
+		{EventGenerated, "revoked", revoked, clock.now.Add(-time.Minute)},
+		{EventRevoked, "revoked", revoked, clock.now.Add(-time.Minute)},
+		{EventGenerated, "expired", expired, clock.now.Add(-time.Minute)},
+		{EventExpired, "expired", expired, clock.now},
+	}
+	var got []Event
+	for event := range events {
+		got = append(got, event)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("unexpected events: %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEventsDrop(t *testing.T) {
+	p := mustNew(t)
+	events := p.Events()
+	for i := 0; i < eventBuffer+10; i++ {
+		p.Generate("device") // генерация не должна блокироваться
+	}
+	if len(events) != eventBuffer {
+		t.Errorf("unexpected buffered events: %d", len(events))
+	}
+	p.StopEvents()
+	p.Generate("device") // отправка в закрытый канал не должна выполняться
+}
+
+func TestEventsClose(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		p := mustNew(t)
+		got := make(chan (<-chan Event))
+		go func() { got <- p.Events() }()
+		p.Close()
+		events := <-got
+		// канал, полученный одновременно с закрытием, тоже должен быть закрыт
+		select {
+		case _, ok := <-events:
+			if ok {
+				t.Fatal("unexpected event")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("events channel left open after close")
+		}
+	}
+}
@@ -0,0 +1,45 @@
+//go:build go1.18
+// +build go1.18
+
+package pairing
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func FuzzGetDeviceID(f *testing.F) {
+	for _, seed := range []string{
+		"", "ABC-DEF", " abc def ", "\xff\xfe", "ABC\x00", "-", "--", "K-",
+		strings.Repeat("A", 10000), "АБВГД", "​", "Á",
+	} {
+		f.Add(seed)
+	}
+	lists := []*Pairs{
+		mustNew(f),
+		mustNew(f, WithGrouping(3, "-"), WithChecksum(), WithCaseInsensitive(),
+			WithInputStripChars(" ._")),
+		mustNew(f, WithPrefix("K-"), WithSegments(DictPronounceable), WithGrouping(2, " ")),
+		mustNew(f, WithRedeemGrace(time.Minute), WithMultiKey()),
+	}
+	for _, p := range lists {
+		key := p.Generate("device")
+		f.Add(key)
+		f.Add(strings.ToLower(key))
+	}
+	f.Fuzz(func(t *testing.T, key string) {
+		goroutines := runtime.NumGoroutine()
+		for _, p := range lists {
+			p.Peek(key)
+			p.TTL(key)
+			p.CheckKey(key)
+			p.Lookup(key)
+			p.GetDeviceID(key)
+		}
+		if n := runtime.NumGoroutine(); n > goroutines {
+			t.Errorf("goroutines leaked: %d > %d", n, goroutines)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package pairing
+
+import "time"
+
+// genCounts описывает моменты генерации ключей для каждого устройства в пределах окна, заданного
+// WithGenerationWindow.
+type genCounts struct {
+	devices map[string][]time.Time // моменты генерации по идентификаторам устройств
+	pruneAt int                    // размер справочника, при котором удаляются устаревшие записи
+}
+
+// countGeneration запоминает момент генерации ключа для устройства, если задано
+// WithGenerationWindow. Должна вызываться под блокировкой.
+func (p *Pairs) countGeneration(deviceID string) {
+	if p.genWindow <= 0 {
+		return
+	}
+	now := p.clock()
+	g := &p.generations
+	if g.devices == nil {
+		g.devices = make(map[string][]time.Time)
+	}
+	if len(g.devices) >= g.pruneAt {
+		// так же, как для использованных ключей, устаревшие записи удаляются, когда справочник
+		// вырастает вдвое
+		g.prune(now.Add(-p.genWindow))
+		g.pruneAt = 2 * len(g.devices)
+		if g.pruneAt < minRedeemedPrune {
+			g.pruneAt = minRedeemedPrune
+		}
+	}
+	times := g.devices[deviceID]
+	g.devices[deviceID] = append(times[:copy(times, since(times, now.Add(-p.genWindow)))], now)
+}
+
+// DeviceGenCount возвращает количество попыток генерации ключа для устройства за последнее
+// время, заданное WithGenerationWindow. Учитываются все вызовы функций генерации для этого
+// устройства, включая возврат уже выданного ключа и завершившиеся ошибкой после проверки
+// идентификатора устройства, поэтому значение позволяет обнаружить клиентов, слишком часто
+// запрашивающих новые ключи. Без этой опции всегда возвращает 0.
+func (p *Pairs) DeviceGenCount(deviceID string) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.genWindow <= 0 {
+		return 0
+	}
+	return len(since(p.generations.devices[deviceID], p.clock().Add(-p.genWindow)))
+}
+
+// prune удаляет моменты генерации до from и устройства, для которых их не осталось.
+func (g *genCounts) prune(from time.Time) {
+	for deviceID, times := range g.devices {
+		if times = since(times, from); len(times) == 0 {
+			delete(g.devices, deviceID)
+		} else {
+			g.devices[deviceID] = times
+		}
+	}
+}
+
+// since возвращает моменты генерации, следующие после from. Моменты упорядочены по времени.
+func since(times []time.Time, from time.Time) []time.Time {
+	for i, t := range times {
+		if t.After(from) {
+			return times[i:]
+		}
+	}
+	return nil
+}
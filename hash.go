@@ -0,0 +1,31 @@
+package pairing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// storeKey возвращает значение, под которым нормализованный ключ сохраняется в хранилище: сам
+// ключ или, если задана опция WithHashedKeys, его хеш в шестнадцатеричном виде.
+func (p *Pairs) storeKey(key string) string {
+	if !p.hashed {
+		return key
+	}
+	if len(p.hashSecret) == 0 {
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, p.hashSecret)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// formatStored возвращает сохраненный в хранилище ключ в виде для вывода. Хеш ключа, сохраненный
+// с WithHashedKeys, на группы не разбивается.
+func (p *Pairs) formatStored(key string) string {
+	if p.hashed {
+		return key
+	}
+	return p.format(p.unscoped(key))
+}
@@ -0,0 +1,201 @@
+package pairing
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// StartJanitor запускает в фоне процесс, который с заданным интервалом удаляет из списка все
+// устаревшие ключи. Возвращаемая функция останавливает этот процесс; ее можно вызывать
+// несколько раз.
+//
+// Без запуска этого процесса устаревшие ключи удаляются только при попытке их использования или
+// при совпадении с вновь сгенерированным ключом, поэтому при большом количестве брошенных
+// привязок память, занимаемая списком, может расти.
+//
+// Все запущенные процессы останавливаются при вызове Close. После закрытия списка процесс не
+// запускается.
+//
+// Для хранилища в памяти, пока процесс запущен, сроки действия ключей дополнительно хранятся в
+// пирамиде, поэтому при очистке проверяются только ключи, срок действия которых действительно
+// истек, а не все ключи. Для других хранилищ при каждой очистке перебираются все записи.
+//
+// Если interval не положителен, то StartJanitor паникует в вызвавшей ее горутине, не запуская
+// процесс.
+func (p *Pairs) StartJanitor(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		panic("pairing: интервал очистки должен быть положительным")
+	}
+	done := make(chan struct{})
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			close(done)
+			p.mu.Lock()
+			if p.sweepers--; p.sweepers == 0 {
+				p.deadlines = nil // пирамида больше не нужна
+			}
+			p.mu.Unlock()
+		})
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return func() {}
+	}
+	p.janitors = append(p.janitors, stop)
+	if p.sweepers++; p.sweepers == 1 {
+		p.init()
+		p.rangeStore(func(kInfo StoreRecord) bool {
+			p.schedule(kInfo) // заполняем пирамиду уже выданными ключами
+			return true
+		})
+	}
+	p.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.purge()
+				p.autoCompact()
+				p.checkFill()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return stop
+}
+
+// purge удаляет из списка все устаревшие ключи, льготный период которых истек, и возвращает их
+// количество.
+func (p *Pairs) purge() int {
+	var expired, deleted []StoreRecord
+	p.mu.Lock()
+	if p.heapSweep() {
+		// записи в пирамиде не удаляются при использовании ключей, поэтому запись о ключе
+		// проверяется повторно: ключ мог быть уже удален, продлен или выдан заново
+		now := p.clock().Add(-p.softGrace) // учитываем льготный период
+		for len(p.deadlines) > 0 && !p.deadlines[0].expires.After(now) {
+			entry := heap.Pop(&p.deadlines).(deadline)
+			if kInfo, ok := p.store.GetByKey(entry.key); ok && p.dead(kInfo) {
+				expired = append(expired, kInfo)
+			}
+		}
+	} else {
+		p.rangeStore(func(kInfo StoreRecord) bool {
+			if p.dead(kInfo) {
+				expired = append(expired, kInfo)
+			}
+			return true
+		})
+	}
+	for _, kInfo := range expired {
+		if p.store.DeleteByKey(kInfo.Key) {
+			deleted = append(deleted, kInfo)
+		}
+	}
+	p.redeemed.prune(p.clock())
+	p.generations.prune(p.clock().Add(-p.genWindow))
+	p.mu.Unlock()
+	p.stats.expired.Add(uint64(len(deleted)))
+	p.notifyExpired(deleted)
+	return len(deleted)
+}
+
+// Compact пересоздает справочники хранилища в памяти с размером, рассчитанным на текущее
+// количество записей, освобождая память, занятую после пиковой нагрузки: справочники Go не
+// уменьшаются при удалении записей. Устаревшие записи при этом не удаляются, поэтому перед сжатием
+// имеет смысл их очистить. Выполняется под блокировкой, поэтому безопасна при одновременной
+// работе с ключами, но на время копирования записей блокирует остальные операции. Хранилища,
+// заданные WithStore, не изменяются.
+func (p *Pairs) Compact() {
+	p.mu.Lock()
+	p.compact()
+	p.mu.Unlock()
+}
+
+// compact пересоздает справочники хранилища в памяти и пирамиду сроков действия ключей. Должна
+// вызываться под блокировкой.
+func (p *Pairs) compact() {
+	if store, ok := p.store.(*memStore); ok {
+		*store = *store.compact()
+	}
+	if cap(p.deadlines) > 2*len(p.deadlines) {
+		p.deadlines = append(deadlines(nil), p.deadlines...)
+	}
+}
+
+// autoCompact пересоздает справочники хранилища в памяти, если количество записей в нем
+// уменьшилось ниже доли, заданной WithCompactThreshold, от наибольшего.
+func (p *Pairs) autoCompact() {
+	if p.compactRatio <= 0 {
+		return
+	}
+	p.mu.Lock()
+	if store, ok := p.store.(*memStore); ok && store.sparse(p.compactRatio) {
+		p.compact()
+	}
+	p.mu.Unlock()
+}
+
+// checkFill вызывает функцию предупреждения, заданную WithFillWarning, если действующие ключи
+// занимают большую долю пространства ключей, чем допустимо. Если хранилище умеет быстро
+// возвращать количество записей, то после очистки оно используется вместо подсчета действующих
+// ключей.
+func (p *Pairs) checkFill() {
+	if p.onFill == nil {
+		return
+	}
+	p.mu.Lock()
+	p.init()
+	var live int
+	if counter, ok := p.store.(interface{ Len() int }); ok {
+		live = counter.Len()
+	} else {
+		live = p.live()
+	}
+	space := p.keySpace(p.Length)
+	p.mu.Unlock()
+	if float64(live) > p.warnFill*space {
+		p.onFill(live, space)
+	}
+}
+
+// heapSweep возвращает true, если для очистки используется пирамида сроков действия ключей.
+func (p *Pairs) heapSweep() bool {
+	_, ok := p.store.(*memStore)
+	return ok && p.sweepers > 0
+}
+
+// schedule добавляет срок действия ключа в пирамиду, если она используется. Должна вызываться
+// под блокировкой после сохранения записи о ключе.
+func (p *Pairs) schedule(kInfo StoreRecord) {
+	if p.heapSweep() {
+		heap.Push(&p.deadlines, deadline{key: kInfo.Key, expires: kInfo.Expires})
+	}
+}
+
+// deadline описывает срок действия ключа в пирамиде.
+type deadline struct {
+	key     string    // ключ
+	expires time.Time // время окончания действия ключа
+}
+
+// deadlines описывает пирамиду сроков действия ключей, в вершине которой находится ближайший.
+// Реализует интерфейс heap.Interface.
+type deadlines []deadline
+
+func (h deadlines) Len() int            { return len(h) }
+func (h deadlines) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h deadlines) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *deadlines) Push(x interface{}) { *h = append(*h, x.(deadline)) }
+func (h *deadlines) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
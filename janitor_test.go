@@ -0,0 +1,139 @@
+package pairing
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestJanitor(t *testing.T) {
+	p := mustNew(t, WithExpire(10*time.Millisecond))
+	for i := 0; i < 10; i++ {
+		p.Generate(fmt.Sprint(i))
+	}
+	stop := p.StartJanitor(5 * time.Millisecond)
+	defer stop()
+	// параллельная генерация не должна мешать очистке
+	for i := 0; i < 100; i++ {
+		p.GetDeviceID(p.Generate("busy"))
+	}
+	time.Sleep(50 * time.Millisecond)
+	if count := p.Len() + p.LenExpired(); count != 0 {
+		t.Errorf("expired keys not purged: %d", count)
+	}
+	stop()
+	stop() // повторный вызов не должен приводить к ошибке
+}
+
+func TestJanitorInterval(t *testing.T) {
+	p := mustNew(t)
+	defer func() {
+		if recover() == nil {
+			t.Error("non-positive interval accepted")
+		}
+		if p.sweepers != 0 || len(p.janitors) != 0 {
+			t.Error("janitor registered")
+		}
+	}()
+	p.StartJanitor(0)
+}
+
+func TestJanitorDeadlines(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute))
+	early := p.Generate("early") // выдан до запуска очистки
+	stop := p.StartJanitor(time.Hour)
+	defer stop()
+	clock.Advance(30 * time.Second)
+	touched := p.Generate("touched")
+	consumed := p.Generate("consumed")
+	p.Generate("late")
+	if len(p.deadlines) != 4 {
+		t.Fatalf("deadlines: %d", len(p.deadlines))
+	}
+	p.GetDeviceID(consumed)
+	clock.Advance(40 * time.Second)
+	if !p.Touch(touched) {
+		t.Fatal("touch failed")
+	}
+	// истек только ключ, выданный до запуска очистки
+	if n := p.purge(); n != 1 {
+		t.Errorf("purged %d keys", n)
+	}
+	if _, ok := p.Peek(early); ok {
+		t.Error("expired key not purged")
+	}
+	clock.Advance(30 * time.Second)
+	// ключ late истек, запись об использованном ключе устарела, а продленный ключ еще действует
+	if n := p.purge(); n != 1 {
+		t.Errorf("purged %d keys", n)
+	}
+	if id, ok := p.Peek(touched); !ok || id != "touched" {
+		t.Error("touched key purged")
+	}
+	if len(p.deadlines) != 1 {
+		t.Errorf("deadlines left: %d", len(p.deadlines))
+	}
+	stop()
+	if p.deadlines != nil {
+		t.Error("deadlines not released")
+	}
+}
+
+func TestFillWarning(t *testing.T) {
+	warned := make(chan int, 10)
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1),
+		WithFillWarning(0.5, func(live int, space float64) {
+			if space != 10 {
+				t.Errorf("unexpected space: %v", space)
+			}
+			warned <- live
+		}))
+	for i := 0; i < 6; i++ {
+		p.Generate(fmt.Sprint(i))
+	}
+	stop := p.StartJanitor(time.Millisecond)
+	defer stop()
+	select {
+	case live := <-warned:
+		if live != 6 {
+			t.Errorf("unexpected live count: %d", live)
+		}
+	case <-time.After(time.Second):
+		t.Error("no fill warning")
+	}
+	if _, err := New(WithFillWarning(0.5, nil)); err == nil {
+		t.Error("nil warning function accepted")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	p := mustNew(t, WithCompactThreshold(0.5))
+	keys, err := p.GenerateN("device", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys[:90] {
+		p.GetDeviceID(key)
+	}
+	store := p.store.(*memStore)
+	if !store.sparse(0.5) || store.peak != 100 {
+		t.Fatalf("store not sparse: %d of %d", store.Len(), store.peak)
+	}
+	p.autoCompact()
+	if store.sparse(0.5) || store.peak != 10 {
+		t.Errorf("store not compacted: %d of %d", store.Len(), store.peak)
+	}
+	for i, key := range keys[90:] {
+		if id, ok := p.Peek(key); !ok || id != fmt.Sprintf("device-%d", 90+i) {
+			t.Errorf("key %q lost", key)
+		}
+	}
+	p.Compact()
+	if p.Len() != 10 {
+		t.Errorf("unexpected length: %d", p.Len())
+	}
+	if _, err := New(WithCompactThreshold(1)); err == nil {
+		t.Error("invalid threshold accepted")
+	}
+}
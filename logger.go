@@ -0,0 +1,13 @@
+package pairing
+
+// Logger описывает журнал, в который выводятся отладочные сообщения о генерации ключей, их
+// совпадениях и истечении времени жизни. Ему удовлетворяет, например, *log.Logger.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// nopLogger описывает журнал по умолчанию, который ничего не выводит.
+type nopLogger struct{}
+
+// Printf ничего не делает.
+func (nopLogger) Printf(string, ...interface{}) {}
@@ -0,0 +1,54 @@
+package pairing
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// MarshalBinary возвращает сохраненное состояние действующих ключей, включая время их генерации.
+// Параметры генерации ключей не сохраняются. Реализует интерфейс encoding.BinaryMarshaler.
+func (p *Pairs) MarshalBinary() ([]byte, error) {
+	var list []StoreRecord
+	p.mu.RLock()
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if !p.expired(kInfo) {
+			list = append(list, kInfo)
+		}
+		return true
+	})
+	p.mu.RUnlock()
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(list); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary восстанавливает состояние ключей, сохраненное с помощью MarshalBinary.
+// Восстановленные ключи добавляются к уже существующим, а ключи, время жизни которых уже истекло,
+// пропускаются. Реализует интерфейс encoding.BinaryUnmarshaler.
+func (p *Pairs) UnmarshalBinary(data []byte) error {
+	var list []StoreRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&list); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	for _, kInfo := range list {
+		if p.expired(kInfo) {
+			continue
+		}
+		var err error
+		if store, ok := p.store.(multiKeyStore); ok && p.multi {
+			err = store.Add(kInfo) // не заменяем другие ключи устройства
+		} else {
+			err = p.store.Put(kInfo)
+		}
+		if err != nil {
+			return err
+		}
+		p.schedule(kInfo)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package pairing
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	p := mustNew(t, WithExpire(time.Minute))
+	key := p.Generate("device")
+	old := p.Generate("expired")
+	p.mu.Lock()
+	kInfo, _ := p.store.GetByKey(old)
+	kInfo.Expires = kInfo.Expires.Add(-time.Hour)
+	p.store.Put(kInfo)
+	p.mu.Unlock()
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := mustNew(t, WithExpire(time.Minute))
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if n := restored.Len() + restored.LenExpired(); n != 1 {
+		t.Errorf("bad restored count: %d", n)
+	}
+	if ttl, ok := restored.TTL(key); !ok || ttl > time.Minute || ttl < 59*time.Second {
+		t.Errorf("bad restored ttl: %v %v", ttl, ok)
+	}
+	if id := restored.GetDeviceID(key); id != "device" {
+		t.Errorf("bad restored device: %q", id)
+	}
+	if err := restored.UnmarshalBinary([]byte("garbage")); err == nil {
+		t.Error("garbage accepted")
+	}
+}
@@ -0,0 +1,641 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Option описывает функцию для задания параметров Pairs при создании через New. Если параметр
+// задан не верно, то функция возвращает ошибку.
+type Option func(*Pairs) error
+
+// WithDictionary задает словарь символов, используемых для генерации ключей. Словарь
+// проверяется с помощью Dictionary.Validate.
+func WithDictionary(dict Dictionary) Option {
+	return func(p *Pairs) error {
+		if err := dict.Validate(); err != nil {
+			return err
+		}
+		p.Dictionary = dict
+		return nil
+	}
+}
+
+// WithSegments задает составной словарь, в котором для разных позиций ключа используются разные
+// наборы символов. Поле Dictionary при этом заменяется словарем из всех символов наборов, который
+// используется для проверок параметров и вычисления контрольного символа. Разделенный на части
+// список такой словарь не поддерживает.
+func WithSegments(segments SegmentedDictionary) Option {
+	return func(p *Pairs) error {
+		if err := segments.Validate(); err != nil {
+			return err
+		}
+		p.segments = segments
+		p.Dictionary = segments.union()
+		return nil
+	}
+}
+
+// WithKeyFunc задает функцию, которая возвращает ключ заданной длины вместо случайной генерации
+// по словарю. Предназначена для тестирования: позволяет получить заранее известную
+// последовательность ключей, например, чтобы проверить повторные попытки при совпадении с уже
+// выданным ключом или исчерпание MaxIter попыток. Возвращенный ключ обрабатывается так же, как
+// сгенерированный: к нему добавляются префикс и контрольный символ, и он проверяется на
+// уникальность. Разделенный на части список эту опцию не поддерживает.
+func WithKeyFunc(f func(length uint8) string) Option {
+	return func(p *Pairs) error {
+		p.keyFunc = f
+		return nil
+	}
+}
+
+// WithLength задает длину генерируемого ключа.
+func WithLength(length uint8) Option {
+	return func(p *Pairs) error {
+		p.Length = length
+		return nil
+	}
+}
+
+// WithAutoWiden разрешает автоматически увеличивать длину ключа до maxLength, если не удалось
+// сгенерировать уникальный ключ заданной длины за MaxIter попыток. Более длинный ключ сохраняется
+// и используется так же, как и остальные. В этом случае ключи перестают иметь одинаковую длину,
+// поэтому опция не включена по умолчанию. Значение maxLength не может быть меньше длины ключа.
+func WithAutoWiden(maxLength uint8) Option {
+	return func(p *Pairs) error {
+		p.autoWiden = maxLength
+		return nil
+	}
+}
+
+// WithLengthLimit задает наибольшую допустимую длину ключа, включая длину при автоматическом
+// удлинении, заданную WithAutoWiden. Ключи предназначены для ручного ввода, поэтому слишком большая
+// длина, скорее всего, означает ошибку в настройках. По умолчанию длина ключа не может превышать 64
+// символов.
+func WithLengthLimit(limit uint8) Option {
+	return func(p *Pairs) error {
+		if limit == 0 {
+			return errors.New("pairing: наибольшая длина ключа должна быть положительной")
+		}
+		p.lengthLimit = limit
+		return nil
+	}
+}
+
+// WithExpire задает время жизни ключа.
+func WithExpire(expire time.Duration) Option {
+	return func(p *Pairs) error {
+		p.Expire = expire
+		return nil
+	}
+}
+
+// WithExpireFunc задает функцию, возвращающую время жизни нового ключа в зависимости от его
+// длины без префикса и контрольного символа, например, чтобы короткие и поэтому легче
+// подбираемые ключи действовали меньше. Функция вызывается при выдаче каждого ключа, в том числе
+// после удлинения ключа WithAutoWiden. Время жизни, явно заданное в GenerateWithExpire, имеет
+// приоритет над этой функцией, а Expire используется, только если функция вернула не
+// положительное значение.
+func WithExpireFunc(f func(length uint8) time.Duration) Option {
+	return func(p *Pairs) error {
+		p.expireFunc = f
+		return nil
+	}
+}
+
+// WithExpireJitter задает наибольшую случайную добавку ко времени жизни каждого нового ключа:
+// срок действия ключа увеличивается на случайное время из интервала [0, d). Это позволяет
+// избежать одновременного устаревания множества ключей, выданных почти одновременно, например,
+// при массовом обновлении устройств, и связанного с этим всплеска нагрузки при очистке. При этом
+// время жизни ключей, видимое пользователям, немного различается: ExpiresFrom добавку не
+// учитывает, а TTL и Inspect возвращают действительный срок действия ключа. По умолчанию добавка
+// не используется.
+func WithExpireJitter(d time.Duration) Option {
+	return func(p *Pairs) error {
+		if d < 0 {
+			return errors.New("pairing: случайная добавка ко времени жизни не может быть отрицательной")
+		}
+		p.expireJitter = d
+		return nil
+	}
+}
+
+// WithGracePeriod задает льготный период после окончания срока действия ключа, в течение которого
+// ключ еще можно использовать с помощью GetDeviceID и Lookup. Это уменьшает количество отказов на
+// границе срока действия, например, из-за расхождения часов клиента и сервера. Новые ключи,
+// совпадающие с ключом в льготном периоде, не выдаются.
+//
+// Во всем остальном ключ в льготном периоде считается устаревшим: TTL и Inspect не находят его,
+// Peek возвращает false, а Len, Range и Snapshot его не учитывают, зато он учитывается в
+// LenExpired как ожидающий удаления. Процесс StartJanitor удаляет такие ключи только после
+// окончания льготного периода. Хранилище Redis удаляет записи по окончании срока действия ключа
+// без учета этого периода. По умолчанию льготный период не используется.
+func WithGracePeriod(d time.Duration) Option {
+	return func(p *Pairs) error {
+		if d < 0 {
+			return errors.New("pairing: льготный период не может быть отрицательным")
+		}
+		p.softGrace = d
+		return nil
+	}
+}
+
+// WithMaxIter задает максимальное количество попыток генерации уникального ключа.
+func WithMaxIter(maxIter uint16) Option {
+	return func(p *Pairs) error {
+		p.MaxIter = maxIter
+		return nil
+	}
+}
+
+// WithMaxActive задает максимальное количество одновременно действующих ключей.
+func WithMaxActive(max int) Option {
+	return func(p *Pairs) error {
+		p.MaxActive = max
+		return nil
+	}
+}
+
+// WithRandSource задает источник случайных данных для генерации ключей. По умолчанию
+// используется crypto/rand. Источник должен быть криптографически стойким, иначе коды
+// активации можно будет предсказать.
+func WithRandSource(src io.Reader) Option {
+	return func(p *Pairs) error {
+		p.rand = src
+		return nil
+	}
+}
+
+// WithStore задает хранилище ключей. По умолчанию ключи хранятся в памяти. Если хранилище
+// используется несколькими экземплярами сервиса, то смотри также WithClock.
+func WithStore(store Store) Option {
+	return func(p *Pairs) error {
+		p.store = store
+		return nil
+	}
+}
+
+// WithGrouping задает разбиение выдаваемого ключа на группы по size символов, разделенные sep,
+// например, "A3F-9QK". Если длина ключа не кратна size, то последняя группа будет короче. В
+// хранилище ключ сохраняется без разделителей, а при проверке ключа разделители игнорируются,
+// поэтому пользователь может вводить его как с ними, так и без них. Разделитель не должен
+// содержать символы словаря.
+func WithGrouping(size int, sep string) Option {
+	return func(p *Pairs) error {
+		if size <= 0 || sep == "" {
+			return errors.New("pairing: не верно задана группировка символов ключа")
+		}
+		p.groupSize, p.groupSep = size, sep
+		return nil
+	}
+}
+
+// WithInputStripChars задает символы, которые удаляются из ключа, введенного пользователем, перед
+// его поиском, например, пробелы, дефисы и точки, добавленные при копировании. В отличие от
+// WithGrouping не влияет на вид выдаваемых ключей. Символы не должны входить в словарь.
+func WithInputStripChars(chars string) Option {
+	return func(p *Pairs) error {
+		p.stripChars = chars
+		return nil
+	}
+}
+
+// WithPrefix задает постоянный префикс, с которого начинаются все генерируемые ключи, например,
+// для определения клиента по ключу. Длина ключа Length задает только длину случайной части, а
+// проверка совпадений и поиск выполняются по полному ключу с префиксом. Префикс не может
+// начинаться или заканчиваться пробельными символами и содержать разделитель групп или символы,
+// заданные WithInputStripChars.
+func WithPrefix(prefix string) Option {
+	return func(p *Pairs) error {
+		p.prefix = prefix
+		return nil
+	}
+}
+
+// WithChecksum добавляет к каждому ключу контрольный символ из словаря, вычисленный по алгоритму
+// Луна. Это позволяет обнаружить большинство ошибок ввода без обращения к хранилищу: Peek и
+// GetDeviceID отвергают такие ключи сразу, Lookup возвращает для них BadChecksum, а CheckKey —
+// ErrBadChecksum. Контрольный символ не входит в длину Length, но сохраняется вместе с ключом.
+func WithChecksum() Option {
+	return func(p *Pairs) error {
+		p.checksum = true
+		return nil
+	}
+}
+
+// WithHashedKeys включает хранение в хранилище вместо самих ключей их хешей HMAC-SHA-256 с
+// секретом secret, так что содержимое хранилища или его копии, полученной MarshalBinary, не
+// раскрывает действующие ключи. Введенный ключ хешируется перед поиском. Без секрета
+// используется простой SHA-256, но так как пространство ключей обычно невелико, ключи по таким
+// хешам легко подобрать перебором, поэтому секрет следует задавать и хранить отдельно от
+// хранилища. Все экземпляры сервиса с общим хранилищем должны использовать один секрет.
+//
+// Так как сами ключи не сохраняются, то HasDevice, Rotate, Range, Snapshot, OnExpire и события об
+// устаревших и отозванных по устройству ключах возвращают вместо ключа его хеш в
+// шестнадцатеричном виде, а WithReuseValid и WithPerDeviceCooldown не поддерживаются.
+func WithHashedKeys(secret []byte) Option {
+	return func(p *Pairs) error {
+		p.hashed = true
+		p.hashSecret = append([]byte(nil), secret...)
+		return nil
+	}
+}
+
+// WithCollisionKey задает функцию, приводящую ключ к виду, в котором ключи сравниваются при
+// проверке уникальности нового ключа: сгенерированный ключ отбрасывается, если для него функция
+// возвращает то же значение, что и для любого из действующих ключей. Это позволяет, например,
+// считать занятыми ключи, которые различаются только префиксом или похожими символами. Функция
+// получает ключ в нормализованном виде, включая префикс и контрольный символ, и вызывается под
+// блокировкой, поэтому не должна обращаться к списку.
+//
+// По умолчанию ключи совпадают, только если совпадают их нормализованные значения, и проверка
+// выполняется поиском в хранилище. С заданной функцией для каждой попытки генерации
+// дополнительно перебираются все записи хранилища, поэтому опция подходит только для небольшого
+// количества одновременно действующих ключей. Функция, возвращающая для разных ключей одно и то
+// же значение, делает занятыми все ключи: генерация завершится ошибкой ErrKeySpaceExhausted
+// после MaxIter попыток. Не совместима с WithHashedKeys, т.к. сами ключи в этом случае не
+// сохраняются. Assign эту функцию не учитывает, а в списке, созданном NewSharded, ключи
+// сравниваются только в пределах одной части.
+func WithCollisionKey(f func(key string) string) Option {
+	return func(p *Pairs) error {
+		p.collisionKey = f
+		return nil
+	}
+}
+
+// WithCaseInsensitive задает режим, в котором регистр символов ключа не учитывается: ключи
+// сохраняются и ищутся в верхнем регистре. Этот режим допустим только для словарей, в которых
+// нет одних и тех же букв в разных регистрах.
+func WithCaseInsensitive() Option {
+	return func(p *Pairs) error {
+		p.caseless = true
+		return nil
+	}
+}
+
+// OutputCase задает регистр символов выдаваемых ключей. Смотри WithOutputCase.
+type OutputCase int
+
+// Режимы регистра выдаваемых ключей.
+const (
+	CaseAsIs  OutputCase = iota // ключи выдаются в том виде, в котором сохраняются
+	CaseUpper                   // ключи выдаются в верхнем регистре
+	CaseLower                   // ключи выдаются в нижнем регистре
+)
+
+// WithOutputCase задает регистр символов выдаваемых ключей независимо от регистра символов
+// словаря. Регистр изменяется только при выводе ключа, а сохраняются, сравниваются при проверке
+// уникальности и ищутся ключи в нормализованном виде, поэтому опция требует WithCaseInsensitive:
+// иначе ключ в измененном регистре не был бы найден.
+func WithOutputCase(mode OutputCase) Option {
+	return func(p *Pairs) error {
+		if mode < CaseAsIs || mode > CaseLower {
+			return fmt.Errorf("pairing: неизвестный режим регистра ключей %d", mode)
+		}
+		p.outputCase = mode
+		return nil
+	}
+}
+
+// WithReuseValid задает режим, в котором Generate для устройства, у которого уже есть
+// действующий ключ, возвращает этот же ключ, не изменяя его время жизни. Новый ключ генерируется
+// только если старого нет или он уже просрочен.
+func WithReuseValid() Option {
+	return func(p *Pairs) error {
+		p.reuse = true
+		return nil
+	}
+}
+
+// WithUniquenessScope задает, в каких пределах выдаваемые ключи уникальны. По умолчанию ключи
+// уникальны среди всех устройств (Global), и ключ сам определяет устройство. С PerDevice ключи
+// уникальны только среди ключей одного устройства, поэтому один и тот же ключ может быть
+// одновременно выдан разным устройствам. В этом случае ключ использовать можно только вместе с
+// идентификатором устройства с помощью LookupDevice и Verify, а функции, принимающие только ключ,
+// например, GetDeviceID, Lookup, TTL и RevokeKey, ключей не находят.
+//
+// Следует учитывать, что с PerDevice ключ не является секретом, по которому определяется
+// устройство: идентификатор устройства передается отдельно и обычно известен, а перебирать
+// нужно только ключи одного устройства. Раз уникальность не требует большого пространства
+// ключей, легко выбрать слишком короткие ключи, поэтому их длину стоит выбирать, исходя из
+// допустимой вероятности подбора, а количество попыток для устройства — ограничивать.
+func WithUniquenessScope(scope UniquenessScope) Option {
+	return func(p *Pairs) error {
+		switch scope {
+		case Global:
+			p.perDevice = false
+		case PerDevice:
+			p.perDevice = true
+		default:
+			return fmt.Errorf("pairing: неизвестная область уникальности ключей %d", scope)
+		}
+		return nil
+	}
+}
+
+// WithNoRotateWhileValid запрещает генерацию нового ключа для устройства, у которого есть
+// действующий ключ: в этом случае функции генерации возвращают ErrKeyStillValid. Это позволяет
+// обнаружить случайную повторную генерацию ключа. Заменить действующий ключ можно только явно:
+// с помощью Rotate или после Revoke. Не совместима с WithReuseValid и WithPerDeviceCooldown, а в
+// режиме WithMultiKey не действует, так как новые ключи там не заменяют выданные.
+func WithNoRotateWhileValid() Option {
+	return func(p *Pairs) error {
+		p.noRotate = true
+		return nil
+	}
+}
+
+// WithPerDeviceCooldown задает время после выдачи ключа, в течение которого повторная генерация
+// ключа для того же устройства возвращает уже выданный действующий ключ вместо нового. Это
+// защищает от клиентов, вызывающих генерацию в цикле. Время отсчитывается от выдачи ключа или
+// его продления с помощью Touch. На Rotate не влияет.
+func WithPerDeviceCooldown(d time.Duration) Option {
+	return func(p *Pairs) error {
+		if d < 0 {
+			return errors.New("pairing: время между генерациями ключей не может быть отрицательным")
+		}
+		p.cooldown = d
+		return nil
+	}
+}
+
+// WithRedeemGrace задает время после использования ключа, в течение которого Lookup для этого
+// ключа возвращает идентификатор устройства и состояние Redeemed вместо NotFound. Это позволяет
+// отличить повторную отправку того же ключа, например, после сбоя сети, от ввода неверного ключа.
+// Повторно ключ при этом не используется: GetDeviceID по-прежнему возвращает пустую строку, а
+// новые ключи, совпадающие с недавно использованными, не выдаются до окончания этого времени. По
+// умолчанию использованные ключи не запоминаются.
+func WithRedeemGrace(d time.Duration) Option {
+	return func(p *Pairs) error {
+		if d < 0 {
+			return errors.New("pairing: время хранения использованных ключей не может быть отрицательным")
+		}
+		p.grace = d
+		return nil
+	}
+}
+
+// WithGenerationWindow включает подсчет попыток генерации ключей для каждого устройства за
+// последнее время window, который возвращает DeviceGenCount. Вместе с WithPerDeviceCooldown это
+// позволяет не только ограничить, но и обнаружить клиентов, слишком часто запрашивающих ключи.
+//
+// Для каждого устройства, запрашивавшего ключ в течение окна, хранится его идентификатор и по 24
+// байта на каждую попытку, даже если действующего ключа у устройства уже нет. Устаревшие записи
+// удаляются процессом StartJanitor, а без него — при росте количества устройств. По умолчанию
+// попытки не подсчитываются.
+func WithGenerationWindow(window time.Duration) Option {
+	return func(p *Pairs) error {
+		if window < 0 {
+			return errors.New("pairing: окно подсчета попыток генерации не может быть отрицательным")
+		}
+		p.genWindow = window
+		return nil
+	}
+}
+
+// WithBatchDedup разрешает повторяющиеся идентификаторы устройств в GenerateBatch: ключ
+// генерируется только для первого вхождения, а повторы пропускаются. По умолчанию повторы
+// считаются ошибкой ErrDuplicateDevice.
+func WithBatchDedup() Option {
+	return func(p *Pairs) error {
+		p.batchDedup = true
+		return nil
+	}
+}
+
+// WithMultiKey разрешает выдавать одному устройству несколько действующих ключей одновременно,
+// например, для спаривания с нескольких консолей. В этом режиме генерация добавляет новый ключ к
+// уже выданным, а не заменяет их, и WithReuseValid с WithPerDeviceCooldown не действуют. Rotate
+// заменяет все ключи устройства одним новым, а Revoke удаляет их все. Любой из ключей устройства
+// можно использовать с GetDeviceID.
+//
+// Ограничение MaxActive в этом режиме учитывает каждый ключ отдельно, поэтому одно устройство
+// может занять его целиком. Хранилище должно поддерживать несколько ключей для устройства: это
+// умеет хранилище в памяти, но не RedisStore.
+func WithMultiKey() Option {
+	return func(p *Pairs) error {
+		p.multi = true
+		return nil
+	}
+}
+
+// WithMinEntropy задает минимально допустимую неопределенность ключа в битах, которая
+// проверяется при создании. По умолчанию не проверяется.
+func WithMinEntropy(bits float64) Option {
+	return func(p *Pairs) error {
+		p.minEntropy = bits
+		return nil
+	}
+}
+
+// WithLogger задает журнал, в который выводятся отладочные сообщения о генерации ключей, их
+// совпадениях при генерации и удалении устаревших ключей. Ключи в сообщениях маскируются с помощью
+// MaskKey. Сообщения о генерации и совпадениях выводятся под блокировкой, поэтому вывод должен
+// быть быстрым и не обращаться к списку. По умолчанию сообщения не выводятся.
+func WithLogger(logger Logger) Option {
+	return func(p *Pairs) error {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithClock задает функцию, возвращающую текущее время, которая используется для всех
+// вычислений времени жизни ключей. По умолчанию используется time.Now. Предназначена в основном
+// для тестирования.
+//
+// Сроки действия ключей сохраняются в хранилище как абсолютное время. Поэтому при использовании
+// общего хранилища, заданного WithStore, часы всех экземпляров сервиса должны совпадать с часами
+// хранилища, иначе ключ может считаться просроченным на экземпляре с опережающими часами. В этом
+// случае следует задать функцию, синхронизированную с временем хранилища, например, с помощью
+// SyncedClock.
+//
+// Показания монотонных часов во времени, возвращаемом функцией, не учитываются: все сроки
+// действия ключей вычисляются по обычным часам, поэтому после приостановки системы ключи
+// устаревают вовремя, но на их срок действия влияет перевод часов.
+func WithClock(now func() time.Time) Option {
+	return func(p *Pairs) error {
+		p.now = now
+		return nil
+	}
+}
+
+// WithInitialCapacity задает ожидаемое количество одновременно действующих ключей, для которого
+// память в хранилище выделяется заранее. Это позволяет избежать многократного увеличения
+// справочников при большой нагрузке. Не положительные значения игнорируются, а слишком большие
+// ограничиваются. Для хранилища, заданного через WithStore, не используется.
+func WithInitialCapacity(n int) Option {
+	return func(p *Pairs) error {
+		if n > maxInitialCount {
+			n = maxInitialCount
+		}
+		p.capacity = n
+		return nil
+	}
+}
+
+// WithMaxDeviceIDLength задает максимальную длину идентификатора устройства в байтах, которая
+// проверяется GenerateE и другими функциями генерации, возвращающими ошибку. По умолчанию длина
+// не ограничена.
+func WithMaxDeviceIDLength(n int) Option {
+	return func(p *Pairs) error {
+		if n <= 0 {
+			return errors.New("pairing: максимальная длина идентификатора должна быть положительной")
+		}
+		p.maxDeviceID = n
+		return nil
+	}
+}
+
+// WithSnapshotMask включает маскирование ключей, возвращаемых Snapshot: видимыми остаются только
+// первые visible символов ключа, а остальные заменяются на '*'. Если visible равно нулю, то ключ
+// маскируется полностью.
+func WithSnapshotMask(visible int) Option {
+	return func(p *Pairs) error {
+		if visible < 0 {
+			return errors.New("pairing: количество видимых символов не может быть отрицательным")
+		}
+		p.mask, p.maskVisible = true, visible
+		return nil
+	}
+}
+
+// WithMaxFill задает допустимую долю занятых действующими ключами значений пространства ключей
+// от 0 до 1. Если новый ключ превысит ее, то генерация сразу возвращает ErrKeySpaceExhausted, не
+// тратя время на MaxIter попыток найти свободный ключ. По умолчанию доля равна 1, т.е. ошибка
+// сразу возвращается, только если пространство ключей заполнено полностью. Проверка выполняется
+// только для хранилищ, умеющих быстро возвращать количество записей, в том числе для хранилища в
+// памяти.
+func WithMaxFill(fraction float64) Option {
+	return func(p *Pairs) error {
+		if !(fraction > 0 && fraction <= 1) {
+			return errors.New("pairing: доля занятых ключей должна быть больше 0 и не больше 1")
+		}
+		p.maxFill = fraction
+		return nil
+	}
+}
+
+// WithCompactThreshold задает долю от 0 до 1, при уменьшении ниже которой количества записей в
+// хранилище в памяти относительно наибольшего с момента создания его справочников процесс
+// очистки, запущенный StartJanitor, сжимает хранилище с помощью Compact. Это освобождает память
+// после пиковой нагрузки. По умолчанию хранилище автоматически не сжимается.
+func WithCompactThreshold(ratio float64) Option {
+	return func(p *Pairs) error {
+		if !(ratio > 0 && ratio < 1) {
+			return errors.New("pairing: доля записей для сжатия должна быть больше 0 и меньше 1")
+		}
+		p.compactRatio = ratio
+		return nil
+	}
+}
+
+// WithFillWarning задает долю пространства ключей от 0 до 1, при превышении которой количеством
+// действующих ключей процесс очистки, запущенный StartJanitor, после каждой очистки вызывает warn
+// с количеством действующих ключей и размером пространства. Это позволяет заранее узнать о
+// необходимости увеличить длину ключа или словарь, пока генерация еще не стала завершаться
+// ошибками. На генерацию ключей не влияет; для ее ограничения используйте MaxActive и
+// WithMaxFill.
+func WithFillWarning(fraction float64, warn func(live int, space float64)) Option {
+	return func(p *Pairs) error {
+		if !(fraction > 0 && fraction <= 1) {
+			return errors.New("pairing: доля занятых ключей должна быть больше 0 и не больше 1")
+		}
+		if warn == nil {
+			return errors.New("pairing: не задана функция предупреждения")
+		}
+		p.warnFill, p.onFill = fraction, warn
+		return nil
+	}
+}
+
+// WithBlocklist задает список слов, которые не должны встречаться в сгенерированных ключах, чтобы
+// ключи можно было безопасно показывать пользователям. Ключ, содержащий любое из этих слов без
+// учета регистра, отбрасывается, и генерируется новый: такие попытки учитываются в ограничении
+// MaxIter. Т.к. каждый ключ проверяется на вхождение всех слов по очереди, большой список
+// замедляет генерацию и уменьшает количество доступных ключей. Пустые слова не допускаются.
+func WithBlocklist(words []string) Option {
+	return func(p *Pairs) error {
+		blocklist := make([]string, len(words))
+		for i, word := range words {
+			if word == "" {
+				return errors.New("pairing: пустое слово в списке запрещенных")
+			}
+			blocklist[i] = strings.ToUpper(word)
+		}
+		p.blocklist = blocklist
+		return nil
+	}
+}
+
+// WithMinDistinctRunes задает минимальное количество разных символов в сгенерированном ключе без
+// учета префикса и контрольного символа, чтобы не выдавать ключи вроде AAAAAA, которые выглядят
+// ненастоящими и легче угадываются. Ключ с меньшим количеством разных символов отбрасывается, и
+// генерируется новый: такие попытки учитываются в ограничении MaxIter.
+//
+// Для небольших словарей и коротких ключей ограничение заметно уменьшает количество доступных
+// ключей: например, для словаря из 4 символов и ключей длиной 4 при n = 4 остается лишь 24 ключа
+// из 256. Значение не может превышать длину ключа и количество символов словаря.
+func WithMinDistinctRunes(n int) Option {
+	return func(p *Pairs) error {
+		if n < 0 {
+			return errors.New("pairing: количество разных символов не может быть отрицательным")
+		}
+		p.minDistinct = n
+		return nil
+	}
+}
+
+// WithReserved задает ключи, которые никогда не будут выданы, например, название компании или
+// ключи из одного повторяющегося символа. В отличие от WithBlocklist ключ отбрасывается только при
+// полном совпадении, как если бы он всегда был занят. Ключи указываются полностью, включая
+// префикс и контрольный символ, если они заданы, и сравниваются после нормализации. Каждый
+// зарезервированный ключ уменьшает количество доступных ключей, поэтому их не должно быть много
+// по сравнению с размером пространства ключей.
+func WithReserved(keys []string) Option {
+	return func(p *Pairs) error {
+		p.reservedKeys = append([]string(nil), keys...)
+		p.reserved = nil // ключи будут нормализованы при инициализации
+		return nil
+	}
+}
+
+// WithShards задает количество независимых частей, на которые разделяется список ключей,
+// создаваемый с помощью NewSharded. Для New этот параметр не допустим.
+func WithShards(n int) Option {
+	return func(p *Pairs) error {
+		if n <= 0 {
+			return errors.New("pairing: количество частей должно быть положительным")
+		}
+		p.shards = n
+		return nil
+	}
+}
+
+// New возвращает новый инициализированный список ключей для спаривания устройств с указанными
+// параметрами. Не заданные параметры сразу принимают значения по умолчанию, поэтому
+// возвращенный объект можно безопасно использовать одновременно из нескольких потоков.
+//
+// Это рекомендуемый способ создания Pairs. Если какой-либо из параметров задан не верно, то
+// возвращается ошибка.
+func New(opts ...Option) (*Pairs, error) {
+	p := new(Pairs)
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.shards > 1 && p.shard == nil {
+		return nil, errors.New("pairing: для разделения списка на части используйте NewSharded")
+	}
+	p.init()
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,729 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	p := mustNew(t)
+	if p.Dictionary != DictAlfa || p.Length != 6 || p.Expire != 30*time.Minute || p.MaxIter != 1000 {
+		t.Errorf("bad defaults: %q %d %v %d", p.Dictionary, p.Length, p.Expire, p.MaxIter)
+	}
+	if p.store == nil {
+		t.Error("store not initialized")
+	}
+	p = mustNew(t, WithDictionary(DictNumber), WithLength(4), WithExpire(time.Minute), WithMaxIter(10))
+	if p.Dictionary != DictNumber || p.Length != 4 || p.Expire != time.Minute || p.MaxIter != 10 {
+		t.Errorf("options not applied: %q %d %v %d", p.Dictionary, p.Length, p.Expire, p.MaxIter)
+	}
+	key := p.Generate("device")
+	if len(key) != 4 {
+		t.Errorf("bad key length: %q", key)
+	}
+	if id := p.GetDeviceID(key); id != "device" {
+		t.Errorf("bad device id: %q", id)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	if _, err := New(WithDictionary("ABCA")); err == nil {
+		t.Error("duplicate characters accepted")
+	}
+	if _, err := New(WithDictionary("")); err != ErrEmptyDictionary {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// mustNew возвращает новый Pairs или прерывает тест в случае ошибки.
+func mustNew(t testing.TB, opts ...Option) *Pairs {
+	t.Helper()
+	p, err := New(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWithGrouping(t *testing.T) {
+	p := mustNew(t, WithLength(7), WithGrouping(3, "-"))
+	key := p.Generate("device")
+	if len(key) != 9 || key[3] != '-' || key[7] != '-' {
+		t.Fatalf("bad grouping: %q", key)
+	}
+	if id, ok := p.Peek(key); !ok || id != "device" {
+		t.Errorf("grouped key not found: %q %v", id, ok)
+	}
+	if id := p.GetDeviceID(strings.Replace(key, "-", "", -1)); id != "device" {
+		t.Errorf("plain key not found: %q", id)
+	}
+	if _, err := New(WithGrouping(0, "-")); err == nil {
+		t.Error("zero group size accepted")
+	}
+	if _, err := New(WithDictionary("AB-"), WithGrouping(2, "-")); err == nil {
+		t.Error("separator from dictionary accepted")
+	}
+}
+
+func TestWithCaseInsensitive(t *testing.T) {
+	p := mustNew(t, WithDictionary("abcdefgh"), WithCaseInsensitive())
+	key := p.Generate("device")
+	if key != strings.ToUpper(key) {
+		t.Errorf("key not canonical: %q", key)
+	}
+	if id, ok := p.Peek(strings.ToLower(key)); !ok || id != "device" {
+		t.Errorf("lower case key not found: %q %v", id, ok)
+	}
+	if id := p.GetDeviceID(key); id != "device" {
+		t.Errorf("upper case key not found: %q", id)
+	}
+	if _, err := New(WithDictionary("abcA"), WithCaseInsensitive()); err == nil {
+		t.Error("mixed case dictionary accepted")
+	}
+}
+
+func TestWithReuseValid(t *testing.T) {
+	p := mustNew(t, WithReuseValid(), WithExpire(20*time.Millisecond))
+	key := p.Generate("device")
+	if again := p.Generate("device"); again != key {
+		t.Errorf("key not reused: %q != %q", again, key)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if again := p.Generate("device"); again == key || again == "" {
+		t.Errorf("expired key reused: %q", again)
+	}
+}
+
+// fakeClock описывает часы для тестов, время которых изменяется только вручную.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestWithClock(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute))
+	key := p.Generate("device")
+	p.Generate("other")
+	clock.Advance(40 * time.Second)
+	if ttl, ok := p.TTL(key); !ok || ttl != 20*time.Second {
+		t.Errorf("bad ttl: %v %v", ttl, ok)
+	}
+	clock.Advance(20 * time.Second)
+	if _, ok := p.Peek(key); ok {
+		t.Error("expired key found")
+	}
+	if n := p.purge(); n != 2 {
+		t.Errorf("bad purged count: %d", n)
+	}
+}
+
+func TestWithInitialCapacity(t *testing.T) {
+	for n, want := range map[int]int{-1: initialCount, 0: initialCount, 50000: 50000,
+		maxInitialCount + 1: maxInitialCount} {
+		var p Pairs // память для хранилища не выделяем
+		if err := WithInitialCapacity(n)(&p); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.initialCapacity(); got != want {
+			t.Errorf("capacity for %d: %d, want %d", n, got, want)
+		}
+	}
+	p := mustNew(t, WithInitialCapacity(1000))
+	if p.Generate("device") == "" {
+		t.Error("empty key")
+	}
+}
+
+func TestWithBlocklist(t *testing.T) {
+	p := mustNew(t, WithDictionary("AB"), WithLength(2), WithBlocklist([]string{"a"}))
+	if key := p.Generate("device"); key != "BB" {
+		t.Errorf("unexpected key %q", key)
+	}
+	if _, err := p.GenerateE("other"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := New(WithBlocklist([]string{""})); err == nil {
+		t.Error("empty word accepted")
+	}
+}
+
+func TestWithCollisionKey(t *testing.T) {
+	// ключи считаются совпадающими без учета последнего символа
+	p := mustNew(t, WithDictionary("AB"), WithLength(2), WithCollisionKey(func(key string) string {
+		return key[:len(key)-1]
+	}))
+	first := p.Generate("one")
+	second := p.Generate("two")
+	if first[0] == second[0] {
+		t.Errorf("similar keys generated: %q %q", first, second)
+	}
+	if _, err := p.GenerateE("three"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// ключ устройства заменяется похожим
+	if _, err := p.GenerateE("one"); err != nil {
+		t.Error(err)
+	}
+	same := func(string) string { return "" }
+	p = mustNew(t, WithCollisionKey(same), WithMaxIter(10))
+	p.Generate("one")
+	if _, err := p.GenerateE("two"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := New(WithCollisionKey(same), WithHashedKeys(nil)); err == nil {
+		t.Error("collision key accepted with hashed keys")
+	}
+}
+
+func TestWithGenerationWindow(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithGenerationWindow(time.Minute), WithReuseValid())
+	for i := 0; i < 3; i++ {
+		p.Generate("device")
+		clock.Advance(20 * time.Second)
+	}
+	p.Generate("other")
+	if n := p.DeviceGenCount("device"); n != 2 {
+		t.Errorf("unexpected count: %d", n)
+	}
+	if n := p.DeviceGenCount("other"); n != 1 {
+		t.Errorf("unexpected count: %d", n)
+	}
+	clock.Advance(time.Minute)
+	p.purge()
+	if n := p.DeviceGenCount("device"); n != 0 || len(p.generations.devices) != 0 {
+		t.Errorf("counts not pruned: %d", n)
+	}
+	if n := mustNew(t).DeviceGenCount("device"); n != 0 {
+		t.Errorf("counted without window: %d", n)
+	}
+	if _, err := New(WithGenerationWindow(-time.Second)); err == nil {
+		t.Error("negative window accepted")
+	}
+}
+
+// testLogger запоминает выведенные сообщения.
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+	l.mu.Unlock()
+}
+
+func TestWithLogger(t *testing.T) {
+	clock := newFakeClock()
+	logger := new(testLogger)
+	p := mustNew(t, WithClock(clock.Now), WithLogger(logger), WithExpire(time.Minute),
+		WithMaxIter(3), WithCollisionKey(func(string) string { return "" }))
+	key := p.Generate("one")
+	p.GenerateE("two") // все попытки совпадают с первым ключом
+	clock.Advance(time.Minute)
+	p.purge()
+	var generated, collisions, expired int
+	for _, line := range logger.lines {
+		if strings.Contains(line, key) {
+			t.Errorf("key not masked: %q", line)
+		}
+		switch {
+		case strings.Contains(line, "add new key"):
+			generated++
+		case strings.Contains(line, "collision"):
+			collisions++
+		case strings.Contains(line, "delete expired key"):
+			expired++
+		}
+	}
+	if generated != 1 || collisions != 3 || expired != 1 {
+		t.Errorf("unexpected log: %q", logger.lines)
+	}
+	// без журнала и с пустым журналом сообщения не выводятся
+	mustNew(t, WithLogger(nil)).Generate("device")
+}
+
+func TestWithExpireJitter(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithExpireJitter(time.Minute))
+	ttls := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		ttl, ok := p.TTL(p.Generate(strconv.Itoa(i)))
+		if !ok || ttl < time.Minute || ttl >= 2*time.Minute {
+			t.Fatalf("unexpected ttl: %v", ttl)
+		}
+		ttls[ttl] = true
+	}
+	if len(ttls) < 2 {
+		t.Error("expiries not spread")
+	}
+	if _, err := New(WithExpireJitter(-time.Second)); err == nil {
+		t.Error("negative jitter accepted")
+	}
+}
+
+func TestWithGracePeriod(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithGracePeriod(10*time.Second),
+		WithDictionary("AB"), WithLength(1))
+	key := p.Generate("device")
+	stop := p.StartJanitor(time.Hour)
+	defer stop()
+	clock.Advance(time.Minute + 5*time.Second)
+	p.purge()
+	if _, ok := p.TTL(key); ok || p.Len() != 0 || p.LenExpired() != 1 {
+		t.Errorf("key in grace period reported as valid: %d %d", p.Len(), p.LenExpired())
+	}
+	// ключ в льготном периоде считается занятым
+	if other := p.Generate("other"); other == key {
+		t.Error("key in grace period reissued")
+	}
+	if id, status := p.Lookup(key); status != Valid || id != "device" {
+		t.Errorf("key in grace period not consumed: %v", status)
+	}
+	key = p.Generate("device")
+	clock.Advance(time.Minute + 10*time.Second)
+	if n := p.purge(); n != 2 {
+		t.Errorf("unexpected purged count: %d", n)
+	}
+	if _, status := p.Lookup(key); status != NotFound {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if _, err := New(WithGracePeriod(-time.Second)); err == nil {
+		t.Error("negative grace period accepted")
+	}
+}
+
+func TestWithLengthLimit(t *testing.T) {
+	if _, err := New(WithLength(65)); err == nil {
+		t.Error("length over default limit accepted")
+	}
+	if _, err := New(WithLength(8), WithAutoWiden(12), WithLengthLimit(10)); err == nil {
+		t.Error("widened length over limit accepted")
+	}
+	if _, err := New(WithLengthLimit(0)); err == nil {
+		t.Error("zero limit accepted")
+	}
+	p := mustNew(t, WithLength(100), WithLengthLimit(100))
+	if key := p.Generate("device"); len(key) != 100 {
+		t.Errorf("unexpected key %q", key)
+	}
+	if err := p.SetLength(101); err == nil {
+		t.Error("length over limit set")
+	}
+	if p.Config().Length != 100 {
+		t.Error("length changed on error")
+	}
+}
+
+func TestWithMinDistinctRunes(t *testing.T) {
+	p := mustNew(t, WithDictionary("AB"), WithLength(2), WithMinDistinctRunes(2), WithPrefix("X"))
+	for _, deviceID := range []string{"one", "two"} {
+		if key := p.Generate(deviceID); key != "XAB" && key != "XBA" {
+			t.Errorf("unexpected key %q", key)
+		}
+	}
+	if _, err := p.GenerateE("three"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, opts := range [][]Option{
+		{WithMinDistinctRunes(-1)},
+		{WithLength(4), WithMinDistinctRunes(5)},
+		{WithDictionary("ABC"), WithMinDistinctRunes(4)},
+	} {
+		if _, err := New(opts...); err == nil {
+			t.Error("invalid distinct runes accepted")
+		}
+	}
+}
+
+func TestWithInputStripChars(t *testing.T) {
+	p := mustNew(t, WithInputStripChars(" -."), WithLength(6))
+	key := p.Generate("device")
+	for _, input := range []string{
+		key[:3] + "-" + key[3:],
+		key[:2] + " " + key[2:4] + "." + key[4:],
+		" " + key[:1] + "--" + key[1:] + ".",
+	} {
+		if id, ok := p.Peek(input); !ok || id != "device" {
+			t.Errorf("key %q not found", input)
+		}
+	}
+	if p.GetDeviceID(key[:3]+"."+key[3:]) != "device" {
+		t.Error("key not consumed")
+	}
+	if _, err := New(WithInputStripChars("-A")); err == nil {
+		t.Error("dictionary char accepted")
+	}
+	if _, err := New(WithInputStripChars("a"), WithCaseInsensitive()); err == nil {
+		t.Error("lowercase dictionary char accepted")
+	}
+}
+
+func TestWithPerDeviceCooldown(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithPerDeviceCooldown(time.Second), WithClock(clock.Now))
+	key := p.Generate("device")
+	if again := p.Generate("device"); again != key {
+		t.Errorf("key changed during cooldown: %q %q", key, again)
+	}
+	clock.Advance(time.Second)
+	if again := p.Generate("device"); again == key {
+		t.Error("key not changed after cooldown")
+	}
+	if _, err := New(WithPerDeviceCooldown(-time.Second)); err == nil {
+		t.Error("negative cooldown accepted")
+	}
+}
+
+func TestWithMultiKey(t *testing.T) {
+	p := mustNew(t, WithMultiKey(), WithReuseValid())
+	first, second := p.Generate("device"), p.Generate("device")
+	if first == second || p.Len() != 2 {
+		t.Fatalf("key replaced: %q %q", first, second)
+	}
+	if p.GetDeviceID(first) != "device" {
+		t.Error("first key not valid")
+	}
+	third := p.Generate("device")
+	if !p.Revoke("device") || p.Len() != 0 {
+		t.Errorf("keys not revoked: %d", p.Len())
+	}
+	for _, key := range []string{second, third} {
+		if _, ok := p.Peek(key); ok {
+			t.Errorf("revoked key %q found", key)
+		}
+	}
+	p.Generate("device")
+	p.Generate("device")
+	if newKey, _ := p.Rotate("device"); p.Len() != 1 || newKey == "" {
+		t.Errorf("rotate kept old keys: %d", p.Len())
+	}
+	if _, err := New(WithMultiKey(), WithStore(&wrapStore{newMemStore(0)})); err == nil {
+		t.Error("single key store accepted")
+	}
+}
+
+func TestWithPrefix(t *testing.T) {
+	p := mustNew(t, WithPrefix("t1-"), WithLength(4), WithGrouping(2, " "), WithCaseInsensitive())
+	key := p.Generate("device")
+	if !strings.HasPrefix(key, "T1-") || len(key) != 8 || key[5] != ' ' {
+		t.Fatalf("unexpected key %q", key)
+	}
+	if p.GetDeviceID(strings.ToLower(key)) != "device" {
+		t.Error("prefixed key not found")
+	}
+	s, err := NewSharded(WithPrefix("T1-"), WithShards(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := s.Generate("device"); s.GetDeviceID(key) != "device" {
+		t.Errorf("sharded prefixed key %q not found", key)
+	}
+	for _, opts := range [][]Option{
+		{WithPrefix(" T")},
+		{WithPrefix("T-"), WithGrouping(2, "-")},
+		{WithPrefix("T."), WithInputStripChars(".")},
+	} {
+		if _, err := New(opts...); err == nil {
+			t.Error("bad prefix accepted")
+		}
+	}
+}
+
+func TestWithReserved(t *testing.T) {
+	p := mustNew(t, WithReserved([]string{"a", " B "}), WithDictionary("ABC"), WithLength(1),
+		WithCaseInsensitive())
+	if key := p.Generate("device"); key != "C" {
+		t.Errorf("unexpected key %q", key)
+	}
+	if _, err := p.GenerateE("other"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if stats := p.Stats(); stats.Collisions == 0 {
+		t.Errorf("reserved keys not counted as collisions: %+v", stats)
+	}
+}
+
+func TestWithAutoWiden(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1), WithAutoWiden(2), WithMaxIter(100))
+	lengths := make(map[int]int)
+	for i := 0; i < 20; i++ {
+		deviceID := strconv.Itoa(i)
+		key, err := p.GenerateE(deviceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lengths[len(key)]++
+		if id, ok := p.Peek(key); !ok || id != deviceID {
+			t.Errorf("key %q not found", key)
+		}
+	}
+	if lengths[1] == 0 || lengths[1] > 10 || lengths[1]+lengths[2] != 20 {
+		t.Errorf("unexpected key lengths: %v", lengths)
+	}
+	if _, err := New(WithLength(6), WithAutoWiden(5)); err == nil {
+		t.Error("short max length accepted")
+	}
+}
+
+func TestWithRedeemGrace(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithRedeemGrace(time.Minute),
+		WithDictionary(DictNum), WithLength(1))
+	key := p.Generate("device")
+	if id, status := p.Lookup(key); id != "device" || status != Valid {
+		t.Fatalf("unexpected result: %q %v", id, status)
+	}
+	// повторная отправка ключа отличается от неверного ключа, но ключ не используется повторно
+	if id, status := p.Lookup(key); id != "device" || status != Redeemed {
+		t.Errorf("unexpected result for redeemed key: %q %v", id, status)
+	}
+	if id := p.GetDeviceID(key); id != "" {
+		t.Errorf("redeemed key consumed again: %q", id)
+	}
+	// недавно использованный ключ не выдается другому устройству
+	for i := 0; i < 9; i++ {
+		if other := p.Generate(strconv.Itoa(i)); other == key || other == "" {
+			t.Fatalf("unexpected key %q", other)
+		}
+	}
+	p.Reset()
+	clock.Advance(time.Minute)
+	if id, status := p.Lookup(key); id != "" || status != NotFound {
+		t.Errorf("unexpected result after grace: %q %v", id, status)
+	}
+	if _, err := New(WithRedeemGrace(-time.Second)); err == nil {
+		t.Error("negative grace accepted")
+	}
+}
+
+func TestWithHashedKeys(t *testing.T) {
+	p := mustNew(t, WithHashedKeys([]byte("secret")), WithGrouping(3, "-"))
+	key := p.Generate("device")
+	data, err := p.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain := strings.ReplaceAll(key, "-", ""); strings.Contains(string(data), plain) {
+		t.Error("plain key stored")
+	}
+	if _, ok := p.TTL(key); !ok {
+		t.Error("hashed key not found")
+	}
+	stored, _, ok := p.HasDevice("device")
+	if !ok || len(stored) != 64 {
+		t.Errorf("unexpected stored key: %q", stored)
+	}
+	if id := p.GetDeviceID(stored); id != "" {
+		t.Error("key found by its hash")
+	}
+	if id := p.GetDeviceID(key); id != "device" {
+		t.Errorf("unexpected device: %q", id)
+	}
+	// без секрета хеши не совпадают с хешами с секретом
+	q := mustNew(t, WithHashedKeys(nil))
+	if p.storeKey("KEY") == q.storeKey("KEY") {
+		t.Error("secret ignored")
+	}
+	if _, err := New(WithHashedKeys(nil), WithReuseValid()); err == nil {
+		t.Error("reuse with hashed keys accepted")
+	}
+}
+
+func TestWithKeyFunc(t *testing.T) {
+	keys := []string{"AAAA", "AAAA", "AAAA", "BBBB"}
+	p := mustNew(t, WithLength(4), WithMaxIter(2), WithKeyFunc(func(length uint8) string {
+		if length != 4 {
+			t.Errorf("unexpected length: %d", length)
+		}
+		key := keys[0]
+		keys = keys[1:]
+		return key
+	}))
+	if key := p.Generate("first"); key != "AAAA" {
+		t.Fatalf("unexpected key: %q", key)
+	}
+	// обе попытки совпадают с уже выданным ключом
+	if _, err := p.GenerateE("second"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if stats := p.Stats(); stats.Collisions != 2 || stats.MaxCollisions != 2 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	// первое совпадение повторяется, а затем используется уникальный ключ
+	keys = []string{"AAAA", "BBBB"}
+	if key := p.Generate("second"); key != "BBBB" {
+		t.Errorf("unexpected key: %q", key)
+	}
+	if _, err := NewSharded(WithKeyFunc(func(uint8) string { return "" })); err == nil {
+		t.Error("key function accepted by sharded list")
+	}
+}
+
+func TestWithNoRotateWhileValid(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithNoRotateWhileValid())
+	key := p.Generate("device")
+	if _, err := p.GenerateE("device"); err != ErrKeyStillValid {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if id, ok := p.Peek(key); !ok || id != "device" {
+		t.Error("valid key replaced")
+	}
+	if newKey, oldKey := p.Rotate("device"); newKey == "" || oldKey != key {
+		t.Errorf("rotate failed: %q %q", newKey, oldKey)
+	}
+	p.Revoke("device")
+	if _, err := p.GenerateE("device"); err != nil {
+		t.Errorf("generate after revoke: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if _, err := p.GenerateE("device"); err != nil {
+		t.Errorf("generate after expiry: %v", err)
+	}
+	if _, err := New(WithNoRotateWhileValid(), WithReuseValid()); err == nil {
+		t.Error("conflicting options accepted")
+	}
+}
+
+func TestWithExpireFunc(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1), WithAutoWiden(2), WithMaxIter(100),
+		WithExpire(time.Hour), WithExpireFunc(func(length uint8) time.Duration {
+			if length == 1 {
+				return time.Minute // короткие ключи действуют меньше
+			}
+			return 0
+		}))
+	for i := 0; i < 20; i++ {
+		key, issued, expires := p.GenerateInfo(strconv.Itoa(i))
+		want := time.Hour
+		if len(key) == 1 {
+			want = time.Minute
+		}
+		if expires.Sub(issued) != want {
+			t.Errorf("unexpected lifetime for %q: %v", key, expires.Sub(issued))
+		}
+	}
+	// явно заданное время жизни имеет приоритет
+	key := p.GenerateWithExpire("explicit", time.Second)
+	if ttl, ok := p.TTL(key); !ok || ttl > time.Second {
+		t.Errorf("unexpected ttl: %v", ttl)
+	}
+}
+
+func TestWithUniquenessScope(t *testing.T) {
+	p := mustNew(t, WithUniquenessScope(PerDevice), WithDictionary(DictNum), WithLength(1))
+	keys := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		deviceID := strconv.Itoa(i)
+		key, err := p.GenerateE(deviceID) // ключей больше, чем всего возможных значений
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[deviceID] = key
+		if stored, _, ok := p.HasDevice(deviceID); !ok || stored != key {
+			t.Errorf("unexpected key for %s: %q", deviceID, stored)
+		}
+	}
+	key := keys["0"]
+	if id := p.GetDeviceID(key); id != "" {
+		t.Errorf("key found without device: %q", id)
+	}
+	if !p.Verify(key, "0") {
+		t.Error("key not verified")
+	}
+	for deviceID, other := range keys {
+		if deviceID != "0" && other != key {
+			if status := p.LookupDevice(deviceID, key); status != NotFound {
+				t.Errorf("key of other device used: %v", status)
+			}
+			break
+		}
+	}
+	if status := p.LookupDevice("0", key); status != Valid {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if status := p.LookupDevice("0", key); status != NotFound {
+		t.Errorf("unexpected status for used key: %v", status)
+	}
+	if _, err := New(WithUniquenessScope(UniquenessScope(5))); err == nil {
+		t.Error("unknown scope accepted")
+	}
+	// ключ вместе с идентификатором устройства не находит ключ этого устройства
+	victim := p.Generate("victim")
+	for _, input := range []string{"victim" + scopeSep + victim, scopeSep + victim} {
+		if id := p.GetDeviceID(input); id != "" {
+			t.Errorf("scoped key of %q used by key-only lookup", id)
+		}
+		if _, status := p.Lookup(input); status != NotFound {
+			t.Errorf("unexpected status: %v", status)
+		}
+		if _, ok := p.Peek(input); ok {
+			t.Error("scoped key found by key-only lookup")
+		}
+	}
+	if status := p.LookupDevice("victim", victim); status != Valid {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if _, err := New(WithUniquenessScope(PerDevice), WithDictionary("AB\x00")); err == nil {
+		t.Error("dictionary with separator accepted")
+	}
+	// для глобальных ключей LookupDevice проверяет владельца
+	q := mustNew(t)
+	key = q.Generate("device")
+	if status := q.LookupDevice("other", key); status != NotFound {
+		t.Errorf("unexpected status: %v", status)
+	}
+	if status := q.LookupDevice("device", key); status != Valid {
+		t.Errorf("unexpected status: %v", status)
+	}
+}
+
+func TestWithOutputCase(t *testing.T) {
+	p := mustNew(t, WithDictionary("abcdefghjk"), WithLength(4), WithCaseInsensitive(),
+		WithOutputCase(CaseLower), WithGrouping(2, "-"))
+	key := p.Generate("device")
+	if key != strings.ToLower(key) {
+		t.Errorf("key not lowercase: %q", key)
+	}
+	if stored, _ := p.KeyForDevice("device"); stored != key {
+		t.Errorf("unexpected stored key: %q", stored)
+	}
+	if id, ok := p.Peek(strings.ToUpper(key)); !ok || id != "device" {
+		t.Error("key not found in other case")
+	}
+	// уникальность проверяется по нормализованному ключу
+	for i := 0; i < 100; i++ {
+		p.GetDeviceID(p.Generate(strconv.Itoa(i)))
+	}
+	if _, err := New(WithOutputCase(CaseUpper)); err == nil {
+		t.Error("output case accepted without case insensitivity")
+	}
+	if _, err := New(WithOutputCase(OutputCase(7)), WithCaseInsensitive()); err == nil {
+		t.Error("unknown case accepted")
+	}
+}
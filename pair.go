@@ -1,111 +1,1258 @@
 package pairing
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
 	"sync"
 	"time"
 )
 
-const initialCount = 100 // изначально выделяем память для хранения стольких одновременных ключей
+const (
+	initialCount    = 100     // изначально выделяем память для хранения стольких одновременных ключей
+	maxInitialCount = 1 << 24 // максимальное количество ключей, для которых память выделяется заранее
+	defaultMaxFill  = 1       // допустимая по умолчанию доля занятых ключей пространства
 
-// keyInfo содержит информацию об устройстве и времени генерации ключа.
-type keyInfo struct {
-	DeviceID string    // уникальный идентификатор устройства
-	Key      string    // уникальный ключ
-	Time     time.Time // время генерации ключа
+	defaultLength  = 6                // длина ключа по умолчанию
+	defaultExpire  = 30 * time.Minute // время жизни ключей по умолчанию
+	defaultMaxIter = 1000             // количество попыток генерации по умолчанию
+	defaultMaxLen  = 64               // наибольшая допустимая по умолчанию длина ключа
+)
+
+// Ошибки генерации ключей.
+var (
+	// ErrKeySpaceExhausted возвращается, если за заданное количество попыток не удалось
+	// сгенерировать уникальный ключ.
+	ErrKeySpaceExhausted = errors.New("pairing: не удалось сгенерировать уникальный ключ")
+	// ErrTooManyKeys возвращается, если достигнуто максимальное количество действующих ключей.
+	ErrTooManyKeys = errors.New("pairing: слишком много действующих ключей")
+	// ErrEmptyDeviceID возвращается при попытке сгенерировать ключ для пустого идентификатора
+	// устройства.
+	ErrEmptyDeviceID = errors.New("pairing: пустой идентификатор устройства")
+	// ErrDeviceIDTooLong возвращается, если идентификатор устройства длиннее допустимого.
+	ErrDeviceIDTooLong = errors.New("pairing: слишком длинный идентификатор устройства")
+	// ErrClosed возвращается при попытке сгенерировать ключ после вызова Close.
+	ErrClosed = errors.New("pairing: список ключей закрыт")
+	// ErrKeyStillValid возвращается при попытке сгенерировать новый ключ для устройства, у которого
+	// есть действующий ключ, если задана опция WithNoRotateWhileValid.
+	ErrKeyStillValid = errors.New("pairing: у устройства есть действующий ключ")
+)
+
+// GenerateError описывает неудачную попытку получить уникальный ключ и содержит сведения о
+// состоянии списка на момент ошибки, по которым можно судить о заполненности пространства ключей.
+// Соответствует ErrKeySpaceExhausted при проверке с помощью errors.Is.
+type GenerateError struct {
+	Attempts     int     // количество сделанных попыток генерации
+	KeySpaceSize float64 // размер пространства ключей наибольшей допустимой длины
+	LiveCount    int     // количество действующих ключей
+}
+
+// Error возвращает описание ошибки.
+func (e *GenerateError) Error() string {
+	return fmt.Sprintf("%v за %d попыток (пространство ключей %.0f, действующих ключей %d)",
+		ErrKeySpaceExhausted, e.Attempts, e.KeySpaceSize, e.LiveCount)
+}
+
+// Is возвращает true для ErrKeySpaceExhausted.
+func (e *GenerateError) Is(target error) bool {
+	return target == ErrKeySpaceExhausted
 }
 
 // Pairs описывает список ключей для спаривания устройств.
+//
+// Рекомендуется создавать его с помощью функции New, которая сразу инициализирует все внутренние
+// структуры и значения по умолчанию. Для обратной совместимости поддерживается и создание
+// объекта напрямую с указанием полей: в этом случае значения по умолчанию будут установлены при
+// первом вызове Generate.
+//
+// Изменять поля напрямую можно только до начала использования объекта. Если параметры нужно
+// изменить, когда возможны одновременные обращения из других потоков, используйте SetExpire и
+// SetLength: прямое присваивание в этом случае приводит к гонке данных.
+//
+// Методы String, MarshalText и UnmarshalText встроенного словаря переопределены для Pairs: String
+// описывает параметры списка, а текстовое представление для Pairs не поддерживается.
 type Pairs struct {
-	Dictionary                     // словарь букв ключа для генерации
-	Length     uint8               // длина ключа
-	Expire     time.Duration       // время жизни ключа
-	MaxIter    uint16              // максимальное количество итераций
-	devices    map[string]*keyInfo // справочник ключей для устройств
-	keys       map[string]*keyInfo // справочник устройств по сгенерированным ключам
-	mu         sync.Mutex
+	Dictionary               // словарь букв ключа для генерации
+	Length     uint8         // длина ключа
+	Expire     time.Duration // время жизни новых ключей; на уже выданные ключи не влияет
+	MaxIter    uint16        // максимальное количество итераций
+	MaxActive  int           // максимальное количество действующих ключей (0 — без ограничений)
+
+	// OnExpire, если задана, вызывается для каждого ключа, удаленного из-за истечения времени
+	// его жизни. Функция вызывается после снятия блокировки, поэтому из нее можно обращаться к
+	// методам Pairs.
+	OnExpire func(deviceID, key string)
+	// OnConsume, если задана, вызывается при успешном использовании ключа в GetDeviceID. В age
+	// передается время, прошедшее с момента генерации ключа. Функция так же вызывается после
+	// снятия блокировки.
+	OnConsume func(deviceID, key string, age time.Duration)
+
+	store        Store                     // хранилище ключей
+	rand         io.Reader                 // источник случайных данных
+	groupSize    int                       // количество символов в группе при выводе ключа
+	groupSep     string                    // разделитель групп символов ключа
+	caseless     bool                      // ключи не зависят от регистра
+	reuse        bool                      // возвращать уже выданный действующий ключ вместо генерации нового
+	minEntropy   float64                   // минимальная неопределенность ключа в битах
+	shards       int                       // количество частей для NewSharded
+	shard        *shard                    // часть разделенного списка, в которую входит этот список
+	stats        counters                  // накопленная статистика
+	now          func() time.Time          // источник текущего времени
+	mask         bool                      // маскировать ключи в Snapshot
+	maskVisible  int                       // количество видимых символов маскированного ключа
+	maxDeviceID  int                       // максимальная длина идентификатора устройства в байтах
+	capacity     int                       // количество ключей, для которых память выделяется заранее
+	maxFill      float64                   // допустимая доля занятых ключей пространства
+	compactRatio float64                   // доля записей от наибольшего количества для сжатия хранилища
+	warnFill     float64                   // доля занятых ключей пространства для предупреждения
+	onFill       func(int, float64)        // функция предупреждения о заполнении пространства
+	logger       Logger                    // журнал отладочных сообщений
+	buf          []rune                    // буфер для генерации ключей, используется под блокировкой
+	blocklist    []string                  // запрещенные в ключах слова в верхнем регистре
+	minDistinct  int                       // минимальное количество разных символов в ключе
+	collisionKey func(string) string       // приведение ключа к виду для проверки уникальности
+	stripChars   string                    // символы, удаляемые из введенных пользователем ключей
+	cooldown     time.Duration             // время, в течение которого ключ устройства не заменяется
+	events       eventStream               // канал событий
+	outputCase   OutputCase                // регистр выдаваемых ключей
+	perDevice    bool                      // ключи уникальны только в пределах устройства
+	noRotate     bool                      // не заменять действующий ключ устройства при генерации
+	batchDedup   bool                      // пропускать повторы устройств в GenerateBatch
+	multi        bool                      // устройству может быть выдано несколько ключей
+	prefix       string                    // постоянный префикс всех ключей
+	checksum     bool                      // добавлять к ключам контрольный символ
+	hashed       bool                      // хранить хеши ключей вместо самих ключей
+	hashSecret   []byte                    // секрет для вычисления хешей ключей
+	reservedKeys []string                  // зарезервированные ключи в том виде, как они были заданы
+	reserved     map[string]bool           // зарезервированные ключи в каноническом виде
+	segments     SegmentedDictionary       // составной словарь, если задан
+	keyFunc      func(uint8) string        // функция генерации ключа вместо словаря, если задана
+	expireFunc   func(uint8) time.Duration // время жизни ключа в зависимости от длины
+	autoWiden    uint8                     // максимальная длина ключа при автоматическом удлинении
+	lengthLimit  uint8                     // наибольшая допустимая длина ключа
+	janitors     []func()                  // функции остановки запущенных процессов очистки
+	sweepers     int                       // количество запущенных процессов очистки
+	deadlines    deadlines                 // пирамида сроков действия ключей для процессов очистки
+	grace        time.Duration             // время хранения недавно использованных ключей
+	redeemed     redemptions               // недавно использованные ключи
+	genWindow    time.Duration             // окно подсчета попыток генерации для устройства
+	expireJitter time.Duration             // наибольшая случайная добавка ко времени жизни ключа
+	softGrace    time.Duration             // льготный период использования устаревшего ключа
+	generations  genCounts                 // моменты генерации ключей по устройствам
+	closed       bool                      // список закрыт
+	mu           sync.RWMutex
 }
 
 // Generate возвращает новый уникальный ключ для спаривания устройства.
 //
 // Если ключ для этого устройства уже был сгенерирован, то старый ключ удаляется и становится
-// не действительным, а создается новый ключ, привязанный к этому устройству. Так же автоматически
+// не действительным, а создается новый ключ, привязанный к этому устройству. Если новый ключ
+// получить не удалось, то старый ключ остается действительным. Так же автоматически
 // удаляются те ключи, которые уже устарели. Если новый ключ не удается получить за заданное
-// количество попыток, то возвращается пустое значение ключа, так что необходима проверка.
+// количество попыток или источник случайных данных вернул ошибку, то возвращается пустое значение
+// ключа, так что необходима проверка. Для получения описания ошибки используйте GenerateE.
 //
 // Параллельное выполнение нескольких функций генерации блокируется. Но, т.к. это достаточно
 // быстрый процесс, то обычно это никак не сказывается на производительности.
 //
 // Если при создании класса словарь, длина, срок жизни и количество итераций не были указаны, то
 // они автоматически примут значения по умолчанию при первом обращении к этой функции: словарь —
-// DictAlfa, длина — 6, время жизни — 30 минут, а количество итераций — 1000.
+// DictAlfa, длина — 6, время жизни — 30 минут, а количество итераций — 1000. При создании через
+// New значения по умолчанию устанавливаются сразу.
+//
+// Для совместимости Generate не проверяет идентификатор устройства и принимает в том числе и
+// пустую строку. Но в этом случае все устройства без идентификатора будут получать ключи для
+// одной и той же записи, заменяя ключи друг друга. GenerateE такие идентификаторы отвергает.
 func (p *Pairs) Generate(deviceID string) (key string) {
+	var expired []StoreRecord
+	p.mu.Lock()
+	key, _ = p.generate(context.Background(), deviceID, true, 0, 0, &expired)
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return
+}
+
+// GenerateE работает так же, как Generate, но в случае неудачи возвращает описание ошибки.
+// Если за заданное количество попыток не удалось получить уникальный ключ, то возвращается
+// ошибка *GenerateError, соответствующая ErrKeySpaceExhausted. Ошибки источника случайных данных и
+// хранилища возвращаются обернутыми.
+//
+// Если задано ограничение MaxActive и количество действующих ключей других устройств уже достигло
+// его, то новый ключ не создается и возвращается ErrTooManyKeys. Устаревшие ключи при этом не
+// учитываются. Т.к. для подсчета перебираются все ключи, то ограничение лучше использовать с
+// хранилищем в памяти.
+//
+// Если задана группировка символов ключа, то возвращается ключ с разделителями групп, но в
+// хранилище сохраняется ключ без них.
+//
+// Для пустого идентификатора устройства возвращается ErrEmptyDeviceID, а если задана опция
+// WithMaxDeviceIDLength и идентификатор длиннее, то ErrDeviceIDTooLong.
+func (p *Pairs) GenerateE(deviceID string) (key string, err error) {
+	return p.GenerateContext(context.Background(), deviceID)
+}
+
+// GenerateContext работает так же, как GenerateE, но перед каждой попыткой генерации ключа
+// проверяет контекст и, если он отменен, возвращает ошибку ctx.Err(). Ограничение MaxIter на
+// количество попыток при этом продолжает действовать.
+func (p *Pairs) GenerateContext(ctx context.Context, deviceID string) (key string, err error) {
+	if err = p.checkDeviceID(deviceID); err != nil {
+		return "", err
+	}
+	var expired []StoreRecord
 	p.mu.Lock() // одновременно выполняется только одна копия
-	// инициализируем списки ключей и словарь, если они не были инициализированы до этого
-	if p.devices == nil {
-		p.devices = make(map[string]*keyInfo, initialCount)
+	key, err = p.generate(ctx, deviceID, true, 0, 0, &expired)
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return
+}
+
+// GenerateWithExpire работает так же, как Generate, но задает для ключа собственное время
+// жизни exp вместо Expire. Это позволяет выдавать ключи с разным временем жизни для разных типов
+// устройств. Если exp равно нулю, то используется Expire.
+func (p *Pairs) GenerateWithExpire(deviceID string, exp time.Duration) (key string) {
+	var expired []StoreRecord
+	p.mu.Lock()
+	key, _ = p.generate(context.Background(), deviceID, true, exp, 0, &expired)
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return
+}
+
+// GenerateInfo работает так же, как Generate, но дополнительно возвращает время выдачи ключа
+// и время окончания его действия. Они определяются под той же блокировкой, что и генерация, поэтому
+// всегда соответствуют возвращенному ключу. Если ключ получить не удалось, то возвращаются пустые
+// значения.
+func (p *Pairs) GenerateInfo(deviceID string) (key string, issuedAt, expiresAt time.Time) {
+	var expired []StoreRecord
+	p.mu.Lock()
+	key, err := p.generate(context.Background(), deviceID, true, 0, 0, &expired)
+	if err == nil {
+		if kInfo, ok := p.store.GetByKey(p.storeKey(p.scoped(deviceID, p.canonical(key)))); ok {
+			issuedAt, expiresAt = kInfo.Time, kInfo.Expires
+		}
+	}
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return
+}
+
+// GenerateMultiUse работает так же, как Generate, но выдает ключ, который можно использовать
+// maxUses раз: GetDeviceID и Lookup уменьшают счетчик использований и удаляют запись о ключе
+// только при последнем использовании. Срок действия ключа при этом ограничен так же, как и для
+// обычных ключей. Если вместо нового ключа возвращается уже выданный устройству действующий ключ
+// (WithReuseValid или WithPerDeviceCooldown), то его оставшееся количество использований не
+// меняется: одноразовый ключ так и остается одноразовым. Если maxUses меньше 1, то ключ не
+// выдается и возвращается пустая строка.
+func (p *Pairs) GenerateMultiUse(deviceID string, maxUses int) (key string) {
+	if maxUses < 1 {
+		return ""
 	}
-	if p.keys == nil {
-		p.keys = make(map[string]*keyInfo, initialCount)
+	var expired []StoreRecord
+	p.mu.Lock()
+	key, _ = p.generate(context.Background(), deviceID, true, 0, maxUses, &expired)
+	p.mu.Unlock()
+	p.notifyExpired(expired)
+	return
+}
+
+// take удаляет запись о ключе и возвращает ее, если запись удалена именно этим вызовом. Если
+// хранилище поддерживает Take, то возвращается удаленная им запись, иначе — прочитанная перед
+// удалением. Должна вызываться под блокировкой.
+func (p *Pairs) take(key string) (StoreRecord, bool) {
+	if store, ok := p.store.(interface {
+		Take(string) (StoreRecord, bool)
+	}); ok {
+		return store.Take(key)
 	}
-	if len(p.Dictionary) == 0 {
-		p.Dictionary = DictAlfa // инициализируем словарь, если он не инициализирован
+	kInfo, ok := p.store.GetByKey(key)
+	return kInfo, ok && p.store.DeleteByKey(key)
+}
+
+// storeByKey возвращает запись по ключу и ошибку хранилища, если хранилище умеет ее сообщать.
+// Должна вызываться под блокировкой.
+func (p *Pairs) storeByKey(key string) (StoreRecord, bool, error) {
+	if store, ok := p.store.(interface {
+		LookupKey(string) (StoreRecord, bool, error)
+	}); ok {
+		return store.LookupKey(key)
 	}
-	if p.Length == 0 {
-		p.Length = 6
+	kInfo, ok := p.store.GetByKey(key)
+	return kInfo, ok, nil
+}
+
+// storeByDevice возвращает запись по идентификатору устройства и ошибку хранилища, если
+// хранилище умеет ее сообщать. Должна вызываться под блокировкой.
+func (p *Pairs) storeByDevice(deviceID string) (StoreRecord, bool, error) {
+	if store, ok := p.store.(interface {
+		LookupDevice(string) (StoreRecord, bool, error)
+	}); ok {
+		return store.LookupDevice(deviceID)
 	}
-	if p.Expire == 0 {
-		p.Expire = time.Minute * 30
+	kInfo, ok := p.store.GetByDevice(deviceID)
+	return kInfo, ok, nil
+}
+
+// save заменяет сохраненную запись о ключе, не затрагивая другие ключи устройства в режиме
+// нескольких ключей. Должна вызываться под блокировкой.
+func (p *Pairs) save(kInfo StoreRecord) error {
+	if p.multi {
+		return p.store.(multiKeyStore).Add(kInfo)
 	}
-	if p.MaxIter == 0 {
-		p.MaxIter = 1000
-	}
-	// проверяем, что для данного устройства нет сгенерированного ключа
-	if kInfo, ok := p.devices[deviceID]; ok {
-		delete(p.keys, kInfo.Key) // удаляем ключ из списка
-		delete(p.devices, kInfo.DeviceID)
-		// log.Printf("Delete key for %q", deviceID)
-	}
-	// делаем несколько попыток генерации нового уникального ключа
-	for i := 0; i < int(p.MaxIter); i++ {
-		key = p.Dictionary.Generate(p.Length) // генерируем случайный ключ по словарю
-		// проверяем, что этот ключ сейчас не используется
-		if kInfo, ok := p.keys[key]; ok {
-			if time.Since(kInfo.Time) < p.Expire {
-				continue // время жизни ключа еще не истекло — пробуем дальше
-			}
-			// ключ используется, но устарел — удаляем записи о нем
-			delete(p.keys, kInfo.Key) // удаляем ключ из списка
-			delete(p.devices, kInfo.DeviceID)
-			// log.Printf("Delete expired key %q", key)
-		}
-		// сгенерированный ключ можно использовать как новый
-		kInfo := &keyInfo{
-			DeviceID: deviceID,
-			Key:      key,
-			Time:     time.Now(),
-		}
-		// заносим его в справочник ключей для устройств
-		p.devices[deviceID] = kInfo
-		p.keys[key] = kInfo
-		// log.Printf("Add new key %q for device %q", key, deviceID)
-		break
+	return p.store.Put(kInfo)
+}
+
+// Rotate генерирует новый ключ для устройства и возвращает его вместе с действующим ключом,
+// который был им заменен. Если действующего ключа у устройства не было, то oldKey пустой. Новый
+// ключ генерируется всегда, даже если задана опция WithReuseValid. Замена выполняется под одной
+// блокировкой, поэтому другие потоки не могут увидеть промежуточное состояние.
+//
+// Если новый ключ получить не удалось, то newKey пустой, а старый ключ остается действительным.
+func (p *Pairs) Rotate(deviceID string) (newKey, oldKey string) {
+	var expired []StoreRecord
+	p.mu.Lock()
+	p.init()
+	if kInfo, ok := p.store.GetByDevice(deviceID); ok && !p.expired(kInfo) {
+		oldKey = p.formatStored(kInfo.Key)
 	}
+	newKey, _ = p.generate(context.Background(), deviceID, false, 0, 0, &expired)
 	p.mu.Unlock()
-	return
+	p.notifyExpired(expired)
+	return newKey, oldKey
+}
+
+// blocked возвращает true, если ключ содержит одно из запрещенных слов без учета регистра.
+func (p *Pairs) blocked(key string) bool {
+	if len(p.blocklist) == 0 {
+		return false
+	}
+	key = strings.ToUpper(key)
+	for _, word := range p.blocklist {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// similar возвращает true, если среди действующих ключей есть ключ, совпадающий с key по функции,
+// заданной WithCollisionKey. Заменяемый ключ устройства replaced не учитывается, а при
+// уникальности в пределах устройства сравниваются только ключи этого устройства.
+func (p *Pairs) similar(deviceID, key, replaced string) (found bool) {
+	class := p.collisionKey(key)
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if kInfo.Key == replaced || p.perDevice && kInfo.DeviceID != deviceID || p.expired(kInfo) {
+			return true
+		}
+		found = p.collisionKey(p.unscoped(kInfo.Key)) == class
+		return !found
+	})
+	return found
+}
+
+// distinctRunes возвращает количество разных символов в ключе.
+func distinctRunes(key string) int {
+	seen := make(map[rune]struct{}, len(key))
+	for _, r := range key {
+		seen[r] = struct{}{}
+	}
+	return len(seen)
+}
+
+// checkDeviceID проверяет допустимость идентификатора устройства.
+func (p *Pairs) checkDeviceID(deviceID string) error {
+	if deviceID == "" {
+		return ErrEmptyDeviceID
+	}
+	if p.maxDeviceID > 0 && len(deviceID) > p.maxDeviceID {
+		return ErrDeviceIDTooLong
+	}
+	return nil
+}
+
+// generate генерирует новый ключ для устройства. Должна вызываться под блокировкой. Если reuse
+// установлен, то вместо генерации может быть возвращен уже выданный устройству действующий ключ,
+// если это разрешено WithReuseValid или WithPerDeviceCooldown, а в режиме WithMultiKey новый ключ
+// добавляется к уже выданным. Иначе новый ключ заменяет все ключи устройства. Если exp не равно
+// нулю, то оно задает время жизни ключа вместо Expire. Если uses больше 1, то новый ключ можно
+// использовать uses раз. Удаленные устаревшие ключи добавляются в expired.
+func (p *Pairs) generate(ctx context.Context, deviceID string, reuse bool, exp time.Duration,
+	uses int, expired *[]StoreRecord) (key string, err error) {
+	if p.closed {
+		return "", ErrClosed
+	}
+	p.init()
+	p.countGeneration(deviceID)
+	// в режиме нескольких ключей новый ключ добавляется к уже выданным, а не заменяет их
+	add := p.multi && reuse
+	// старый ключ устройства удаляется только после того, как новый ключ будет успешно сохранен,
+	// чтобы при ошибке генерации устройство не осталось совсем без ключа
+	var (
+		old    StoreRecord
+		hasOld bool
+	)
+	if !add {
+		if old, hasOld, err = p.storeByDevice(deviceID); err != nil {
+			return "", fmt.Errorf("pairing: ошибка чтения хранилища: %w", err)
+		}
+	}
+	oldLive := hasOld && !p.expired(old)
+	if oldLive && reuse && (p.reuse || p.clock().Sub(old.Time) < p.cooldown) {
+		return p.formatStored(old.Key), nil // используем уже выданный ключ
+	}
+	if oldLive && reuse && p.noRotate {
+		return "", ErrKeyStillValid // заменять действующий ключ можно только явно
+	}
+	if p.MaxActive > 0 {
+		count := p.live()
+		if oldLive {
+			count-- // ключ этого устройства будет заменен
+		}
+		if count >= p.MaxActive {
+			return "", ErrTooManyKeys
+		}
+	}
+	// делаем несколько попыток генерации нового уникального ключа, а если это не удалось и задана
+	// опция WithAutoWiden, то повторяем их для ключей большей длины
+	var (
+		collisions int // количество совпадений при генерации этого ключа
+		attempts   int // общее количество попыток для всех длин ключа
+	)
+	for length := p.Length; ; length++ {
+		if p.full(length, oldLive) {
+			if length >= p.maxLength() {
+				break
+			}
+			continue // не тратим попытки на почти заполненное пространство
+		}
+		for i := 0; i < int(p.MaxIter); i++ {
+			if err = ctx.Err(); err != nil {
+				return "", err
+			}
+			attempts++
+			if cap(p.buf) < int(length) {
+				p.buf = make([]rune, length)
+			}
+			buf := p.buf[:length] // буфер используется повторно для всех попыток
+			switch {
+			case p.keyFunc != nil:
+				key = p.keyFunc(length)
+			case p.segments != nil:
+				key, err = p.segments.GenerateInto(buf, p.rand)
+			case p.shard != nil:
+				key, err = p.shard.generate(buf, p.rand, p.Dictionary)
+			default:
+				key, err = p.Dictionary.GenerateInto(buf, p.rand) // генерируем случайный ключ по словарю
+			}
+			if err != nil {
+				return "", fmt.Errorf("pairing: ошибка источника случайных данных: %w", err)
+			}
+			if p.minDistinct > 0 && distinctRunes(key) < p.minDistinct {
+				continue // ключ из слишком малого количества разных символов — пробуем другой
+			}
+			if key = p.canonical(p.prefix + key); key == "" {
+				return "", errors.New("pairing: сгенерирован недопустимый ключ")
+			}
+			if p.checksum {
+				check, ok := luhn(p.checkDictionary(), []rune(key[len(p.canonicalPrefix()):]))
+				if !ok {
+					return "", errors.New("pairing: символ ключа не входит в словарь")
+				}
+				key += string(check)
+			}
+			if p.blocked(key) {
+				continue // ключ содержит запрещенное слово — пробуем другой
+			}
+			if _, ok := p.reserved[key]; ok {
+				collisions++
+				p.collision(collisions)
+				continue // зарезервированный ключ считается всегда занятым
+			}
+			// в хранилище ключ может храниться в виде хеша или вместе с идентификатором устройства
+			stored := p.storeKey(p.scoped(deviceID, key))
+			if _, ok := p.redemption(stored); ok {
+				collisions++
+				p.collision(collisions)
+				continue // недавно использованный ключ пока не выдается повторно
+			}
+			// проверяем, что этот ключ сейчас не используется
+			current, taken, err := p.storeByKey(stored)
+			if err != nil {
+				return "", fmt.Errorf("pairing: ошибка чтения хранилища: %w", err)
+			}
+			if taken {
+				if !p.dead(current) {
+					collisions++
+					p.collision(collisions)
+					continue // время жизни ключа еще не истекло — пробуем дальше
+				}
+				// ключ выдан, но устарел, и льготный период истек — удаляем записи о нем
+				p.store.DeleteByKey(stored)
+				*expired = append(*expired, current)
+				p.stats.expired.Add(1)
+				if current.Key == old.Key {
+					hasOld = false // это и был старый ключ устройства
+				}
+			}
+			if p.collisionKey != nil && p.similar(deviceID, key, old.Key) {
+				collisions++
+				p.collision(collisions)
+				continue // ключ считается совпадающим с одним из действующих
+			}
+			// сгенерированный ключ можно использовать как новый
+			if exp == 0 {
+				exp = p.lifetime(length)
+			}
+			now := p.clock()
+			kInfo := StoreRecord{
+				DeviceID: deviceID,
+				Key:      stored,
+				Time:     now,
+				Expires:  now.Add(exp + p.jitter()), // срок действия фиксируется при выдаче ключа
+				Uses:     uses,
+			}
+			// заносим его в справочник ключей для устройств, заменяя старый ключ устройства
+			if add {
+				err = p.store.(multiKeyStore).Add(kInfo)
+			} else {
+				err = p.store.Put(kInfo)
+			}
+			if errors.Is(err, ErrKeyInUse) {
+				collisions++
+				p.collision(collisions)
+				continue // ключ успел выдать другой экземпляр сервиса
+			}
+			if err != nil {
+				return "", fmt.Errorf("pairing: ошибка сохранения ключа: %w", err)
+			}
+			p.schedule(kInfo)
+			p.logger.Printf("pairing: add new key %q for device %q", MaskKey(p.format(key)), deviceID)
+			if hasOld && !oldLive {
+				*expired = append(*expired, old)
+				p.stats.expired.Add(1)
+			}
+			p.stats.generated.Add(1)
+			key = p.format(key)
+			p.emit(EventGenerated, deviceID, key) // отправка не блокируется, поэтому возможна под блокировкой
+			return key, nil
+		}
+		if length >= p.maxLength() {
+			break
+		}
+	}
+	return "", &GenerateError{
+		Attempts:     attempts,
+		KeySpaceSize: p.keySpace(p.maxLength()),
+		LiveCount:    p.live(),
+	}
 }
 
 // GetDeviceID возвращает уникальный идентификатор устройства, связанный с указанным ключем
 // активации. При этом запись об этом устройстве из базы удаляется. Если такого устройства не
-// найдено или ключ просрочен, то возвращается пустая строка.
+// найдено или ключ просрочен, то возвращается пустая строка. Запись о ключе, выданном
+// GenerateMultiUse, удаляется только при последнем использовании.
+//
+// Ключ можно указывать как с разделителями групп символов, так и без них. Начальные и конечные
+// пробельные символы игнорируются.
+//
+// Сначала ключ ищется под блокировкой только на чтение, поэтому множество одновременных проверок
+// несуществующих ключей не блокирует друг друга. Полная блокировка устанавливается только если
+// ключ найден, после чего он проверяется повторно.
 func (p *Pairs) GetDeviceID(key string) (deviceID string) {
+	deviceID, _ = p.Resolve(key, true)
+	return
+}
+
+// Resolve возвращает уникальный идентификатор устройства, связанный с указанным ключем. Если
+// consume установлен, то ключ используется и удаляется, как в GetDeviceID, иначе запись о нем
+// сохраняется, как в Peek. Если действующий ключ не найден, то возвращается false.
+func (p *Pairs) Resolve(key string, consume bool) (deviceID string, ok bool) {
+	if consume {
+		if deviceID, status := p.Lookup(key); status == Valid {
+			return deviceID, true
+		}
+		return "", false // недавно использованный ключ повторно не используется
+	}
+	key = p.canonical(key)
+	if p.checkKey(key) != nil {
+		return "", false
+	}
+	p.mu.RLock()
+	if kInfo, found := p.get(p.storeKey(key)); found && !p.expired(kInfo) {
+		deviceID, ok = kInfo.DeviceID, true
+	}
+	p.mu.RUnlock()
+	return
+}
+
+// Lookup работает так же, как GetDeviceID, но дополнительно возвращает состояние ключа, что
+// позволяет отличить просроченный ключ от неверного. Действующий ключ (Valid) при этом
+// используется и удаляется, а просроченный (Expired) — просто удаляется, и идентификатор
+// устройства для него не возвращается. Для неизвестного ключа возвращается NotFound, а для ключа
+// с неверным контрольным символом, если задана опция WithChecksum, — BadChecksum.
+//
+// Поиск и удаление ключа выполняются под одной блокировкой, поэтому из нескольких одновременных
+// запросов с одним ключом его использует только один. Если задана опция WithRedeemGrace, то
+// остальные, а также повторные запросы в течение заданного времени получают состояние Redeemed
+// вместе с идентификатором устройства, которому ключ был выдан.
+//
+// Ключ считается использованным, только если запись о нем удалена именно этим вызовом, поэтому
+// и с хранилищем, общим для нескольких экземпляров сервиса, ключ использует только один из них, а
+// остальные получают NotFound. Многоразовый ключ, выданный GenerateMultiUse, для этого удаляется
+// и сохраняется заново, так что на это время другие экземпляры его не находят. Счетчик его
+// использований при этом точен, только если хранилище поддерживает Take, как хранилище в памяти и
+// RedisStore.
+func (p *Pairs) Lookup(key string) (deviceID string, status Status) {
+	key = p.canonical(key)
+	if p.checkKey(key) != nil {
+		return "", BadChecksum // ключ введен с ошибкой — хранилище не проверяем
+	}
+	return p.lookup(key, p.storeKey(key), "", 0)
+}
+
+// GetDeviceIDMinTTL работает так же, как GetDeviceID, но использует ключ, только если до окончания
+// его действия осталось не меньше min. Ключ, срок действия которого истекает раньше, считается
+// устаревшим и удаляется. Это защищает от использования ключа в последний момент, когда его
+// обратный отсчет на экране уже почти закончился.
+func (p *Pairs) GetDeviceIDMinTTL(key string, min time.Duration) string {
+	key = p.canonical(key)
+	if p.checkKey(key) != nil {
+		return ""
+	}
+	if deviceID, status := p.lookup(key, p.storeKey(key), "", min); status == Valid {
+		return deviceID
+	}
+	return ""
+}
+
+// lookup находит и использует ключ plain, уже приведенный к каноническому виду и проверенный,
+// который сохранен в хранилище под значением key. Если owner не пустой, то ключи других
+// устройств считаются не найденными. Ключ, до окончания действия которого осталось меньше
+// minTTL, считается устаревшим.
+func (p *Pairs) lookup(plain, key, owner string, minTTL time.Duration) (deviceID string,
+	status Status) {
+	p.mu.RLock()
+	kInfo, ok := p.get(key)
+	ok = ok && (owner == "" || kInfo.DeviceID == owner)
+	redeemed, wasRedeemed := p.redemption(key)
+	wasRedeemed = wasRedeemed && (owner == "" || redeemed.DeviceID == owner)
+	p.mu.RUnlock()
+	if !ok {
+		if wasRedeemed {
+			return redeemed.DeviceID, Redeemed
+		}
+		return "", NotFound
+	}
+	var (
+		expired  []StoreRecord
+		consumed StoreRecord
+	)
+	p.mu.Lock()
+	// пока блокировка была снята, ключ мог быть уже использован, поэтому проверяем его заново
+	if consumed, ok = p.get(key); ok && (owner == "" || consumed.DeviceID == owner) {
+		// с общим хранилищем ключ может одновременно использовать другой экземпляр сервиса,
+		// поэтому ключ считается использованным только тем, чей вызов удалил запись о нем
+		consumed, ok = p.take(key)
+		switch {
+		case !ok:
+			status = NotFound
+		case owner != "" && consumed.DeviceID != owner:
+			p.save(consumed) // ключ успели выдать другому устройству — возвращаем запись
+			status = NotFound
+		case p.dead(consumed) || minTTL > 0 && consumed.Expires.Sub(p.clock()) < minTTL:
+			expired, status = append(expired, consumed), Expired
+		case consumed.Uses > 1:
+			// многоразовый ключ сохраняется заново с уменьшенным счетчиком; если сохранить его
+			// не удалось, то ключ теряется, но лишнего использования не будет
+			status = Valid
+			consumed.Uses--
+			p.save(consumed)
+		default:
+			status = Valid
+			p.redeem(consumed)
+		}
+	} else if redeemed, ok = p.redemption(key); ok && (owner == "" || redeemed.DeviceID == owner) {
+		deviceID, status = redeemed.DeviceID, Redeemed // ключ только что использован другим запросом
+	}
+	p.mu.Unlock()
+	// счетчики атомарные, поэтому изменяются уже без блокировки
+	p.stats.expired.Add(uint64(len(expired)))
+	p.notifyExpired(expired)
+	if status == Valid {
+		p.stats.consumed.Add(1)
+		deviceID = consumed.DeviceID
+		p.emit(EventConsumed, deviceID, p.format(plain))
+		if p.OnConsume != nil {
+			p.OnConsume(deviceID, p.format(plain), p.clock().Sub(consumed.Time))
+		}
+	}
+	return
+}
+
+// Peek возвращает уникальный идентификатор устройства, связанный с указанным ключем активации,
+// но, в отличии от GetDeviceID, не удаляет запись о нем. Если такого устройства не найдено или
+// ключ просрочен, то возвращается false.
+func (p *Pairs) Peek(key string) (deviceID string, ok bool) {
+	return p.Resolve(key, false)
+}
+
+// Verify возвращает true, если ключ действителен и выдан указанному устройству. Запись о ключе
+// при этом не удаляется, поэтому проверку можно использовать для подтверждения действий уже
+// привязанного устройства. Идентификаторы устройств сравниваются за постоянное время. Работает и
+// для ключей, уникальных только в пределах устройства, смотри WithUniquenessScope.
+func (p *Pairs) Verify(key, expectedDeviceID string) bool {
+	if p.perDevice {
+		return p.verifyDevice(expectedDeviceID, key)
+	}
+	deviceID, ok := p.Resolve(key, false)
+	return ok && subtle.ConstantTimeCompare([]byte(deviceID), []byte(expectedDeviceID)) == 1
+}
+
+// TTL возвращает оставшееся время жизни указанного ключа. Если ключ не найден или уже просрочен,
+// то возвращается false.
+func (p *Pairs) TTL(key string) (ttl time.Duration, ok bool) {
+	key = p.storeKey(p.canonical(key))
+	p.mu.RLock()
+	if kInfo, found := p.get(key); found && !p.expired(kInfo) {
+		ttl, ok = p.ttl(kInfo), true
+	}
+	p.mu.RUnlock()
+	return
+}
+
+// HasDevice возвращает действующий ключ, уже выданный для устройства, и оставшееся время его
+// жизни, не генерируя новый ключ. Если ключа нет или он уже просрочен, то возвращается false.
+func (p *Pairs) HasDevice(deviceID string) (key string, ttl time.Duration, ok bool) {
+	p.mu.RLock()
+	if p.store != nil {
+		if kInfo, found := p.store.GetByDevice(deviceID); found && !p.expired(kInfo) {
+			key, ttl, ok = p.formatStored(kInfo.Key), p.ttl(kInfo), true
+		}
+	}
+	p.mu.RUnlock()
+	return
+}
+
+// KeyForDevice возвращает действующий ключ устройства, не используя и не заменяя его, например,
+// чтобы сотрудник поддержки мог сообщить ключ пользователю. Это обратная к Peek операция. Проверка
+// прав на получение ключа остается за вызывающей стороной. Если ключа нет, он уже просрочен или
+// задана опция WithHashedKeys и сам ключ не сохраняется, то возвращается false. В режиме
+// WithMultiKey возвращается последний выданный ключ.
+func (p *Pairs) KeyForDevice(deviceID string) (key string, ok bool) {
+	if p.hashed {
+		return "", false
+	}
+	key, _, ok = p.HasDevice(deviceID)
+	return key, ok
+}
+
+// Touch продлевает время жизни действующего ключа, отсчитывая его заново с текущего момента.
+// Возвращает false, если ключ не найден или уже просрочен: просроченный ключ продлить нельзя.
+func (p *Pairs) Touch(key string) (ok bool) {
+	p.mu.Lock()
+	key = p.storeKey(p.canonical(key))
+	if p.store != nil {
+		if kInfo, found := p.store.GetByKey(key); found && !p.expired(kInfo) {
+			now := p.clock()
+			kInfo.Expires = now.Add(kInfo.Expires.Sub(kInfo.Time)) // сохраняем время жизни ключа
+			kInfo.Time = now
+			if ok = p.save(kInfo) == nil; ok { // другие ключи устройства не затрагиваются
+				p.schedule(kInfo)
+			}
+		}
+	}
+	p.mu.Unlock()
+	return
+}
+
+// Revoke удаляет ключ, выданный для указанного устройства, делая его недействительным. В режиме
+// WithMultiKey удаляются все ключи устройства. Возвращает true, если такой ключ был найден.
+func (p *Pairs) Revoke(deviceID string) (ok bool) {
+	var revoked []StoreRecord
+	p.mu.Lock()
+	switch store := p.store.(type) {
+	case nil:
+	case multiKeyStore:
+		revoked = store.ByDevice(deviceID)
+		ok = store.DeleteByDevice(deviceID)
+	default:
+		if kInfo, found := store.GetByDevice(deviceID); found {
+			revoked = append(revoked, kInfo)
+		}
+		ok = store.DeleteByDevice(deviceID)
+	}
+	p.mu.Unlock()
+	if ok {
+		for _, kInfo := range revoked {
+			p.emit(EventRevoked, deviceID, p.formatStored(kInfo.Key))
+		}
+	}
+	return
+}
+
+// RevokePrefix удаляет все ключи устройств, идентификаторы которых начинаются с prefix, например,
+// все ключи одного клиента, и возвращает количество удаленных ключей. Хранилище перебирается под
+// блокировкой, поэтому ключи, сгенерированные одновременно с удалением, либо удаляются, либо
+// выдаются уже после него. Пустой префикс ничего не удаляет: для удаления всех ключей используйте
+// Reset.
+func (p *Pairs) RevokePrefix(prefix string) int {
+	if prefix == "" {
+		return 0
+	}
+	var matched, revoked []StoreRecord
+	p.mu.Lock()
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if strings.HasPrefix(kInfo.DeviceID, prefix) {
+			matched = append(matched, kInfo)
+		}
+		return true
+	})
+	for _, kInfo := range matched {
+		if p.store.DeleteByKey(kInfo.Key) {
+			revoked = append(revoked, kInfo)
+		}
+	}
+	p.mu.Unlock()
+	for _, kInfo := range revoked {
+		p.emit(EventRevoked, kInfo.DeviceID, p.formatStored(kInfo.Key))
+	}
+	return len(revoked)
+}
+
+// RevokeKey удаляет указанный ключ и связанную с ним запись об устройстве. Возвращает true, если
+// такой ключ был найден, даже если его время жизни уже истекло.
+func (p *Pairs) RevokeKey(key string) (ok bool) {
+	var kInfo StoreRecord
+	p.mu.Lock()
+	plain := p.canonical(key)
+	key = p.storeKey(plain)
+	if p.store != nil {
+		kInfo, _ = p.store.GetByKey(key)
+		ok = p.store.DeleteByKey(key)
+	}
+	p.mu.Unlock()
+	if ok {
+		p.emit(EventRevoked, kInfo.DeviceID, p.format(plain))
+	}
+	return
+}
+
+// SetExpire безопасно изменяет время жизни ключей, даже если со списком одновременно работают
+// другие потоки. Новое время жизни применяется только к ключам, выданным после изменения, т.к.
+// срок действия уже выданных ключей фиксируется при их выдаче. Нулевое значение восстанавливает
+// время жизни по умолчанию.
+func (p *Pairs) SetExpire(d time.Duration) {
+	p.mu.Lock()
+	p.Expire = d
+	p.init()
+	p.mu.Unlock()
+}
+
+// SetLength безопасно изменяет длину генерируемых ключей, даже если со списком одновременно
+// работают другие потоки. Уже выданные ключи остаются действительными. Нулевое значение
+// восстанавливает длину по умолчанию. Если длина превышает допустимую, заданную WithLengthLimit,
+// то она не изменяется и возвращается ошибка.
+func (p *Pairs) SetLength(length uint8) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.checkLength(length); err != nil {
+		return err
+	}
+	p.Length = length
+	p.init()
+	return nil
+}
+
+// checkLength проверяет, что длина ключа не превышает допустимую.
+func (p *Pairs) checkLength(length uint8) error {
+	limit := p.lengthLimit
+	if limit == 0 {
+		limit = defaultMaxLen
+	}
+	if length > limit {
+		return fmt.Errorf("pairing: длина ключа %d больше допустимой %d: ключи такой длины "+
+			"неудобно вводить вручную", length, limit)
+	}
+	return nil
+}
+
+// Reset удаляет все ключи и обнуляет накопленную статистику, сохраняя настройки списка. Для
+// удаленных ключей OnExpire не вызывается. Справочники хранилища в памяти при этом заменяются
+// новыми, а из хранилища, заданного через WithStore, записи удаляются по одной. Функцию можно
+// вызывать одновременно с генерацией ключей в других потоках.
+func (p *Pairs) Reset() {
 	p.mu.Lock()
-	if kInfo, ok := p.keys[key]; ok {
-		delete(p.keys, kInfo.Key)
-		delete(p.devices, kInfo.DeviceID)
-		if time.Since(kInfo.Time) < p.Expire {
-			deviceID = kInfo.DeviceID
+	switch store := p.store.(type) {
+	case nil:
+	case *memStore:
+		*store = *newMemStore(p.initialCapacity())
+	default:
+		var keys []string
+		store.Range(func(kInfo StoreRecord) bool {
+			keys = append(keys, kInfo.Key)
+			return true
+		})
+		for _, key := range keys {
+			store.DeleteByKey(key)
 		}
 	}
+	p.stats.reset()
+	p.deadlines = nil // все записи пирамиды устарели
+	p.redeemed = redemptions{}
+	p.generations = genCounts{}
+	p.mu.Unlock()
+}
+
+// Close закрывает список: останавливает все запущенные StartJanitor процессы очистки и закрывает
+// канал событий. После закрытия функции генерации возвращают ErrClosed, а ключи больше не
+// находятся: GetDeviceID возвращает пустую строку, а Lookup — NotFound. Повторный вызов ничего не
+// делает. Всегда возвращает nil и реализует интерфейс io.Closer.
+func (p *Pairs) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	janitors := p.janitors
+	p.janitors = nil
+	p.mu.Unlock()
+	for _, stop := range janitors {
+		stop()
+	}
+	p.stopEvents(true)
+	return nil
+}
+
+// Len возвращает количество действующих ключей. Устаревшие, но еще не удаленные ключи не
+// учитываются.
+func (p *Pairs) Len() (count int) {
+	p.mu.RLock()
+	count = p.live()
+	p.mu.RUnlock()
+	return
+}
+
+// Range вызывает f для каждого действующего ключа, передавая идентификатор устройства, ключ и
+// время, прошедшее с момента его выдачи. Устаревшие ключи пропускаются. Перебор прекращается,
+// если f возвращает false. Порядок перебора не определен. Полное описание каждого ключа передает
+// RangeInfo.
+//
+// Функция f вызывается под блокировкой, поэтому внутри нее нельзя обращаться к методам Pairs.
+func (p *Pairs) Range(f func(deviceID, key string, age time.Duration) bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	now := p.clock()
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if p.expired(kInfo) {
+			return true
+		}
+		return f(kInfo.DeviceID, p.formatStored(kInfo.Key), now.Sub(kInfo.Time))
+	})
+}
+
+// LenExpired возвращает количество устаревших ключей, которые еще не были удалены из списка.
+func (p *Pairs) LenExpired() (count int) {
+	p.mu.RLock()
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if p.expired(kInfo) {
+			count++
+		}
+		return true
+	})
+	p.mu.RUnlock()
+	return
+}
+
+// EntropyBits возвращает неопределенность новых ключей в битах, т.е. двоичный логарифм размера
+// пространства ключей длины Length. Контрольный символ и префикс ее не увеличивают.
+func (p *Pairs) EntropyBits() float64 {
+	p.mu.Lock()
+	p.init()
+	bits := math.Log2(p.keySpace(p.Length))
 	p.mu.Unlock()
+	return bits
+}
+
+// init инициализирует хранилище ключей и устанавливает значения по умолчанию для тех
+// параметров, которые не были заданы. Вызывается при создании через New или под блокировкой при
+// первой генерации ключа.
+func (p *Pairs) init() {
+	if p.store == nil {
+		p.store = newMemStore(p.initialCapacity())
+	}
+	if len(p.Dictionary) == 0 {
+		p.Dictionary = DictAlfa // инициализируем словарь, если он не инициализирован
+	}
+	if p.Length == 0 {
+		p.Length = defaultLength
+	}
+	if p.Expire == 0 {
+		p.Expire = defaultExpire
+	}
+	if p.MaxIter == 0 {
+		p.MaxIter = defaultMaxIter
+	}
+	if p.reserved == nil && len(p.reservedKeys) > 0 {
+		// ключи нормализуются здесь, чтобы учесть все параметры независимо от порядка опций
+		p.reserved = make(map[string]bool, len(p.reservedKeys))
+		for _, key := range p.reservedKeys {
+			p.reserved[p.canonical(key)] = true
+		}
+	}
+	if p.logger == nil {
+		p.logger = nopLogger{}
+	}
+	if p.rand == nil {
+		// случайные данные читаются только под блокировкой, поэтому их можно буферизовать
+		p.rand = bufio.NewReaderSize(rand.Reader, 256)
+	}
+}
+
+// initialCapacity возвращает количество ключей, для которых выделяется память в хранилище.
+func (p *Pairs) initialCapacity() int {
+	if p.capacity <= 0 {
+		return initialCount
+	}
+	return p.capacity
+}
+
+// get возвращает запись по ключу, если хранилище уже инициализировано и список не закрыт.
+func (p *Pairs) get(key string) (kInfo StoreRecord, ok bool) {
+	if p.store != nil && !p.closed {
+		kInfo, ok = p.store.GetByKey(key)
+	}
+	return
+}
+
+// rangeStore перебирает все записи хранилища, если оно уже инициализировано.
+func (p *Pairs) rangeStore(f func(kInfo StoreRecord) bool) {
+	if p.store != nil {
+		p.store.Range(f)
+	}
+}
+
+// format возвращает ключ в виде для вывода: разбитый на группы символов, если группировка задана,
+// и в регистре, заданном WithOutputCase. Префикс ключа на группы не разбивается.
+func (p *Pairs) format(key string) string {
+	key = p.group(key)
+	switch p.outputCase {
+	case CaseUpper:
+		key = strings.ToUpper(key)
+	case CaseLower:
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// group возвращает ключ, разбитый на группы символов, если группировка задана.
+func (p *Pairs) group(key string) string {
+	if p.groupSize <= 0 || p.groupSep == "" {
+		return key
+	}
+	var b strings.Builder
+	if prefix := p.canonicalPrefix(); prefix != "" && strings.HasPrefix(key, prefix) {
+		b.WriteString(prefix)
+		key = key[len(prefix):]
+	}
+	runes := []rune(key)
+	for i, r := range runes {
+		if i > 0 && i%p.groupSize == 0 {
+			b.WriteString(p.groupSep)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// NormalizeKey возвращает ключ, введенный пользователем, без начальных и конечных пробельных
+// символов. Все методы Pairs, принимающие ключ, выполняют эту нормализацию сами, но ее можно
+// использовать и для предварительной обработки ключа перед передачей.
+func NormalizeKey(key string) string {
+	return strings.TrimSpace(key)
+}
+
+// canonicalPrefix возвращает префикс ключей в том виде, в котором он сохраняется в хранилище.
+func (p *Pairs) canonicalPrefix() string {
+	if p.caseless {
+		return strings.ToUpper(p.prefix)
+	}
+	return p.prefix
+}
+
+// canonical возвращает ключ в том виде, в котором он сохраняется в хранилище: без начальных и
+// конечных пробельных символов, без разделителей групп символов и символов, заданных
+// WithInputStripChars, и в верхнем регистре, если регистр не учитывается. Если ключи уникальны
+// только в пределах устройства, то для ключа с разделителем scopeSep возвращается пустая строка:
+// иначе по такому ключу нашлась бы запись о ключе другого устройства.
+func (p *Pairs) canonical(key string) string {
+	if p.perDevice && strings.Contains(key, scopeSep) {
+		return ""
+	}
+	key = NormalizeKey(key)
+	if p.groupSep != "" {
+		key = strings.Replace(key, p.groupSep, "", -1)
+	}
+	if p.stripChars != "" && strings.ContainsAny(key, p.stripChars) {
+		key = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(p.stripChars, r) {
+				return -1 // символ удаляется
+			}
+			return r
+		}, key)
+	}
+	if p.caseless {
+		key = strings.ToUpper(key)
+	}
+	return key
+}
+
+// collision учитывает в статистике повторную попытку генерации ключа из-за совпадения. В n
+// передается количество совпадений при генерации текущего ключа.
+func (p *Pairs) collision(n int) {
+	p.logger.Printf("pairing: key collision, attempt %d", n)
+	p.stats.collisions.Add(1)
+	for cur := p.stats.maxCollisions.Load(); uint64(n) > cur; cur = p.stats.maxCollisions.Load() {
+		if p.stats.maxCollisions.CompareAndSwap(cur, uint64(n)) {
+			break
+		}
+	}
+}
+
+// notifyExpired отправляет события и вызывает OnExpire для всех удаленных устаревших ключей.
+// Должна вызываться без блокировки.
+func (p *Pairs) notifyExpired(expired []StoreRecord) {
+	for _, kInfo := range expired {
+		key := p.formatStored(kInfo.Key)
+		p.logger.Printf("pairing: delete expired key %q for device %q", MaskKey(key), kInfo.DeviceID)
+		p.emit(EventExpired, kInfo.DeviceID, key)
+		if p.OnExpire != nil {
+			p.OnExpire(kInfo.DeviceID, key)
+		}
+	}
+}
+
+// live возвращает количество действующих ключей в хранилище.
+func (p *Pairs) live() (count int) {
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if !p.expired(kInfo) {
+			count++
+		}
+		return true
+	})
 	return
 }
+
+// full возвращает true, если новый ключ превысит допустимую долю занятых ключей пространства. Ключ
+// устройства, который будет заменен, если own установлен, не учитывается. Для подсчета ключей
+// перебираются все записи, поэтому проверка выполняется, только если хранилище умеет быстро
+// возвращать количество записей и оно превышает допустимое значение.
+func (p *Pairs) full(length uint8, own bool) bool {
+	counter, ok := p.store.(interface{ Len() int })
+	if !ok || p.perDevice {
+		return false // у каждого устройства свое пространство ключей
+	}
+	limit := p.maxFill
+	if limit == 0 {
+		limit = defaultMaxFill
+	}
+	limit *= p.keySpace(length)
+	if float64(counter.Len()) < limit {
+		return false
+	}
+	count := p.live()
+	if own {
+		count--
+	}
+	return float64(count) >= limit // новый ключ превысит допустимую долю
+}
+
+// keySpace возвращает количество возможных ключей заданной длины. Для части разделенного списка
+// учитывается, что первый символ ключа выбирается только из ее подмножества словаря.
+func (p *Pairs) keySpace(length uint8) float64 {
+	return p.keySpaceOf(p.Dictionary, length)
+}
+
+// keySpaceOf возвращает количество возможных ключей заданной длины для словаря dict.
+func (p *Pairs) keySpaceOf(dict Dictionary, length uint8) float64 {
+	if p.segments != nil {
+		return p.segments.KeySpace(length)
+	}
+	size := math.Pow(float64(dict.Len()), float64(length))
+	if p.shard != nil {
+		size = size / float64(dict.Len()) * float64(p.shard.first.Len())
+	}
+	return size
+}
+
+// lifetime возвращает время жизни нового ключа заданной длины с учетом WithExpireFunc.
+func (p *Pairs) lifetime(length uint8) time.Duration {
+	if p.expireFunc != nil {
+		if exp := p.expireFunc(length); exp > 0 {
+			return exp
+		}
+	}
+	return p.Expire
+}
+
+// jitter возвращает случайную добавку ко времени жизни нового ключа из интервала [0, d), где d
+// задано WithExpireJitter. Должна вызываться под блокировкой.
+func (p *Pairs) jitter() time.Duration {
+	if p.expireJitter <= 0 {
+		return 0
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(p.rand, b[:]); err != nil {
+		return 0 // без добавки ключ все равно действует заданное время
+	}
+	return time.Duration(binary.BigEndian.Uint64(b[:]) % uint64(p.expireJitter))
+}
+
+// maxLength возвращает максимальную длину ключа с учетом WithAutoWiden.
+func (p *Pairs) maxLength() uint8 {
+	return p.maxLengthOf(p.Length)
+}
+
+// maxLengthOf возвращает максимальную длину ключа с учетом WithAutoWiden для длины length.
+func (p *Pairs) maxLengthOf(length uint8) uint8 {
+	if p.autoWiden > length {
+		return p.autoWiden
+	}
+	return length
+}
+
+// clock возвращает текущее время без показаний монотонных часов.
+//
+// Сроки действия ключей — это моменты по обычным часам: они сохраняются в хранилищах и
+// сравниваются между экземплярами сервиса. Монотонные часы при этом только мешают: после
+// приостановки системы они отстают от обычных часов, и если время выдачи и текущее время
+// содержат их показания, то ключ продолжает действовать все время приостановки. Поэтому
+// показания монотонных часов отбрасываются, и все вычисления выполняются по обычным часам.
+func (p *Pairs) clock() time.Time {
+	if p.now != nil {
+		return p.now().Round(0)
+	}
+	return time.Now().Round(0)
+}
+
+// expired возвращает true, если время жизни ключа истекло.
+func (p *Pairs) expired(kInfo StoreRecord) bool {
+	return p.ttl(kInfo) <= 0
+}
+
+// dead возвращает true, если истек не только срок действия ключа, но и льготный период, заданный
+// WithGracePeriod, в течение которого ключ еще можно использовать.
+func (p *Pairs) dead(kInfo StoreRecord) bool {
+	return p.ttl(kInfo) <= -p.softGrace
+}
+
+// ttl возвращает оставшееся время жизни ключа.
+func (p *Pairs) ttl(kInfo StoreRecord) time.Duration {
+	return kInfo.Expires.Sub(p.clock())
+}
@@ -1,9 +1,17 @@
 package pairing
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPairs(t *testing.T) {
@@ -15,3 +23,847 @@ func TestPairs(t *testing.T) {
 		fmt.Println(deviceID, key, pairs.GetDeviceID(key))
 	}
 }
+
+func TestGenerateE(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNumber), WithLength(1), WithMaxIter(100))
+	for i := 0; i < 10; i++ {
+		if _, err := p.GenerateE(fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.GenerateE("overflow"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	errRead := errors.New("read error")
+	p = mustNew(t, WithRandSource(errReader{errRead}))
+	if _, err := p.GenerateE("device"); !errors.Is(err, errRead) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if key := p.Generate("device"); key != "" {
+		t.Errorf("unexpected key %q", key)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	p := mustNew(t, WithExpire(20*time.Millisecond))
+	if _, ok := p.Peek("unknown"); ok {
+		t.Error("unknown key found")
+	}
+	key := p.Generate("device")
+	for i := 0; i < 2; i++ {
+		if id, ok := p.Peek(key); !ok || id != "device" {
+			t.Errorf("bad peek: %q %v", id, ok)
+		}
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := p.Peek(key); ok {
+		t.Error("expired key found")
+	}
+}
+
+func TestLen(t *testing.T) {
+	p := mustNew(t, WithExpire(20*time.Millisecond))
+	for i := 0; i < 5; i++ {
+		p.Generate(fmt.Sprint(i))
+	}
+	if n := p.Len(); n != 5 {
+		t.Errorf("bad len: %d", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	p.Generate("new")
+	if n, e := p.Len(), p.LenExpired(); n != 1 || e != 5 {
+		t.Errorf("bad len: %d, expired: %d", n, e)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	p := mustNew(t)
+	key := p.Generate("device")
+	if p.Revoke("unknown") {
+		t.Error("unknown device revoked")
+	}
+	if !p.Revoke("device") {
+		t.Error("device not revoked")
+	}
+	if id := p.GetDeviceID(key); id != "" {
+		t.Errorf("revoked key is valid: %q", id)
+	}
+	if p.Revoke("device") {
+		t.Error("device revoked twice")
+	}
+}
+
+func TestRevokeKey(t *testing.T) {
+	p := mustNew(t, WithExpire(20*time.Millisecond))
+	key := p.Generate("device")
+	if p.RevokeKey("unknown") {
+		t.Error("unknown key revoked")
+	}
+	if !p.RevokeKey(key) {
+		t.Error("key not revoked")
+	}
+	if p.Revoke("device") {
+		t.Error("device record not removed")
+	}
+	key = p.Generate("device")
+	time.Sleep(30 * time.Millisecond)
+	if !p.RevokeKey(key) {
+		t.Error("expired key not revoked")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(time.Minute), WithClock(clock.Now))
+	if _, ok := p.TTL("unknown"); ok {
+		t.Error("unknown key found")
+	}
+	key := p.Generate("device")
+	if ttl, ok := p.TTL(key); !ok || ttl != time.Minute {
+		t.Errorf("bad ttl: %v %v", ttl, ok)
+	}
+	clock.Advance(time.Minute)
+	if _, ok := p.TTL(key); ok {
+		t.Error("expired key found")
+	}
+}
+
+func TestTouch(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(40*time.Millisecond), WithClock(clock.Now))
+	key := p.Generate("device")
+	clock.Advance(25 * time.Millisecond)
+	if !p.Touch(key) {
+		t.Fatal("key not touched")
+	}
+	clock.Advance(25 * time.Millisecond)
+	if _, ok := p.Peek(key); !ok {
+		t.Error("touched key expired")
+	}
+	clock.Advance(50 * time.Millisecond)
+	if p.Touch(key) {
+		t.Error("expired key touched")
+	}
+}
+
+func TestTouchMultiKey(t *testing.T) {
+	p := mustNew(t, WithMultiKey())
+	first := p.Generate("device")
+	second := p.Generate("device")
+	if !p.Touch(first) {
+		t.Fatal("key not touched")
+	}
+	if _, ok := p.Peek(second); !ok {
+		t.Error("other key of device removed")
+	}
+}
+
+func TestMaxActive(t *testing.T) {
+	p := mustNew(t, WithMaxActive(2), WithExpire(20*time.Millisecond))
+	p.Generate("a")
+	p.Generate("b")
+	if _, err := p.GenerateE("c"); err != ErrTooManyKeys {
+		t.Errorf("unexpected error: %v", err)
+	}
+	// повторная генерация для уже учтенного устройства разрешена
+	if _, err := p.GenerateE("b"); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, err := p.GenerateE("c"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	var expired []string
+	p := mustNew(t, WithExpire(10*time.Millisecond))
+	p.OnExpire = func(deviceID, key string) {
+		p.Len() // обращение к Pairs не должно приводить к блокировке
+		expired = append(expired, deviceID)
+	}
+	p.Generate("consumed")
+	key := p.Generate("read")
+	p.Generate("rotated")
+	p.Generate("purged")
+	if p.GetDeviceID(p.Generate("consumed")) != "consumed" {
+		t.Fatal("key not consumed")
+	}
+	time.Sleep(20 * time.Millisecond)
+	p.GetDeviceID(key)
+	p.Generate("rotated")
+	p.purge()
+	if fmt.Sprint(expired) != "[read rotated purged]" {
+		t.Errorf("unexpected expired: %v", expired)
+	}
+}
+
+func TestOnConsume(t *testing.T) {
+	var consumed []string
+	p := mustNew(t, WithExpire(20*time.Millisecond))
+	p.OnConsume = func(deviceID, key string, age time.Duration) {
+		if age <= 0 || age > time.Second {
+			t.Errorf("bad age: %v", age)
+		}
+		p.Generate(deviceID) // обращение к Pairs не должно приводить к блокировке
+		consumed = append(consumed, deviceID)
+	}
+	p.GetDeviceID(p.Generate("valid"))
+	key := p.Generate("expired")
+	time.Sleep(30 * time.Millisecond)
+	p.GetDeviceID(key)
+	p.GetDeviceID("unknown")
+	if fmt.Sprint(consumed) != "[valid]" {
+		t.Errorf("unexpected consumed: %v", consumed)
+	}
+}
+
+func TestGenerateContext(t *testing.T) {
+	p := mustNew(t)
+	key, err := p.GenerateContext(context.Background(), "device")
+	if err != nil || key == "" {
+		t.Fatalf("bad key: %q %v", key, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.GenerateContext(ctx, "device"); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNormalizeKey(t *testing.T) {
+	if key := NormalizeKey(" \tABC123\n"); key != "ABC123" {
+		t.Errorf("bad normalized key: %q", key)
+	}
+	p := mustNew(t, WithGrouping(3, "-"))
+	key := p.Generate("device")
+	if id, ok := p.Peek("  " + key + " "); !ok || id != "device" {
+		t.Errorf("key with spaces not found: %q %v", id, ok)
+	}
+	if id := p.GetDeviceID(" " + strings.Replace(key, "-", "", -1)); id != "device" {
+		t.Errorf("key with spaces not found: %q", id)
+	}
+}
+
+func TestHasDevice(t *testing.T) {
+	p := mustNew(t, WithExpire(20*time.Millisecond), WithGrouping(3, "-"))
+	if _, _, ok := p.HasDevice("device"); ok {
+		t.Error("unknown device found")
+	}
+	key := p.Generate("device")
+	if k, ttl, ok := p.HasDevice("device"); !ok || k != key || ttl <= 0 {
+		t.Errorf("bad device key: %q %v %v", k, ttl, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, _, ok := p.HasDevice("device"); ok {
+		t.Error("expired key found")
+	}
+}
+
+func TestGenerateKeepsOldKey(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1), WithMaxIter(100))
+	for i := 0; i < 10; i++ {
+		p.Generate(fmt.Sprint(i))
+	}
+	key, _, _ := p.HasDevice("0")
+	// все ключи заняты, поэтому новый ключ получить нельзя, но старый должен остаться
+	if _, err := p.GenerateE("0"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if id, ok := p.Peek(key); !ok || id != "0" {
+		t.Errorf("old key lost: %q %v", id, ok)
+	}
+	// после освобождения ключа генерация должна заменить старый ключ
+	p.Revoke("1")
+	newKey, err := p.GenerateE("0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Peek(key); ok || newKey == key {
+		t.Errorf("old key %q not replaced by %q", key, newKey)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	p := mustNew(t, WithReuseValid())
+	newKey, oldKey := p.Rotate("device")
+	if newKey == "" || oldKey != "" {
+		t.Fatalf("unexpected first rotate: %q %q", newKey, oldKey)
+	}
+	key2, old2 := p.Rotate("device")
+	if key2 == "" || key2 == newKey || old2 != newKey {
+		t.Errorf("unexpected rotate: %q %q (was %q)", key2, old2, newKey)
+	}
+	if _, ok := p.Peek(newKey); ok {
+		t.Error("old key still valid")
+	}
+	if id, ok := p.Peek(key2); !ok || id != "device" {
+		t.Errorf("new key not valid: %q %v", id, ok)
+	}
+}
+
+func TestGenerateWithExpire(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(time.Minute), WithClock(clock.Now))
+	short := p.Generate("kiosk")
+	long := p.GenerateWithExpire("sensor", 24*time.Hour)
+	if long == "" {
+		t.Fatal("empty key")
+	}
+	if ttl, ok := p.TTL(long); !ok || ttl != 24*time.Hour {
+		t.Errorf("unexpected ttl: %v %v", ttl, ok)
+	}
+	clock.Advance(time.Hour)
+	if _, ok := p.Peek(short); ok {
+		t.Error("short key not expired")
+	}
+	if id, ok := p.Peek(long); !ok || id != "sensor" {
+		t.Errorf("long key expired: %q %v", id, ok)
+	}
+	// нулевое значение означает время жизни по умолчанию
+	key := p.GenerateWithExpire("default", 0)
+	if ttl, ok := p.TTL(key); !ok || ttl != time.Minute {
+		t.Errorf("unexpected default ttl: %v %v", ttl, ok)
+	}
+}
+
+func TestExpireChange(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(time.Hour), WithClock(clock.Now))
+	key := p.Generate("device")
+	// изменение времени жизни не должно влиять на уже выданные ключи
+	p.Expire = time.Minute
+	clock.Advance(30 * time.Minute)
+	if ttl, ok := p.TTL(key); !ok || ttl != 30*time.Minute {
+		t.Errorf("unexpected ttl: %v %v", ttl, ok)
+	}
+	if !p.Touch(key) {
+		t.Fatal("touch failed")
+	}
+	if ttl, _ := p.TTL(key); ttl != time.Hour {
+		t.Errorf("touch changed lifetime: %v", ttl)
+	}
+}
+
+func TestRange(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now))
+	p.GenerateWithExpire("expired", time.Second)
+	keys := map[string]string{"a": p.Generate("a")}
+	clock.Advance(time.Minute)
+	keys["b"] = p.Generate("b")
+	found := make(map[string]string)
+	p.Range(func(deviceID, key string, age time.Duration) bool {
+		if deviceID == "a" && age != time.Minute || deviceID == "b" && age != 0 {
+			t.Errorf("bad age for %q: %v", deviceID, age)
+		}
+		found[deviceID] = key
+		return true
+	})
+	if len(found) != 2 || found["a"] != keys["a"] || found["b"] != keys["b"] {
+		t.Errorf("unexpected range result: %v", found)
+	}
+	var count int
+	p.Range(func(deviceID, key string, age time.Duration) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Errorf("range not stopped: %d", count)
+	}
+}
+
+func TestDeviceIDValidation(t *testing.T) {
+	p := mustNew(t, WithMaxDeviceIDLength(6))
+	if _, err := p.GenerateE(""); err != ErrEmptyDeviceID {
+		t.Errorf("unexpected error for empty id: %v", err)
+	}
+	if _, err := p.GenerateE("too long"); err != ErrDeviceIDTooLong {
+		t.Errorf("unexpected error for long id: %v", err)
+	}
+	if _, err := p.GenerateE("device"); err != nil {
+		t.Error(err)
+	}
+	// для совместимости Generate пустой идентификатор принимает
+	if p.Generate("") == "" {
+		t.Error("legacy generate rejected empty id")
+	}
+	if _, err := New(WithMaxDeviceIDLength(0)); err == nil {
+		t.Error("zero length accepted")
+	}
+}
+
+func TestReset(t *testing.T) {
+	for _, store := range []Store{nil, newMemStore(0), &wrapStore{newMemStore(0)}} {
+		opts := []Option{WithExpire(time.Minute)}
+		if store != nil {
+			opts = append(opts, WithStore(store))
+		}
+		p := mustNew(t, opts...)
+		key := p.Generate("device")
+		p.Generate("other")
+		p.Reset()
+		if p.Len() != 0 || p.LenExpired() != 0 {
+			t.Errorf("keys not removed: %d", p.Len())
+		}
+		if _, ok := p.Peek(key); ok {
+			t.Error("old key found")
+		}
+		if stats := p.Stats(); stats != (Stats{}) {
+			t.Errorf("stats not reset: %+v", stats)
+		}
+		if p.Expire != time.Minute || p.Generate("device") == "" {
+			t.Error("settings lost")
+		}
+	}
+}
+
+// wrapStore скрывает тип хранилища в памяти, чтобы проверить работу с внешним хранилищем.
+type wrapStore struct{ Store }
+
+func TestMaxFill(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1), WithMaxFill(0.5))
+	for i := 0; i < 5; i++ {
+		if _, err := p.GenerateE(fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := p.Stats()
+	if _, err := p.GenerateE("full"); !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if stats := p.Stats(); stats != before {
+		t.Errorf("generation attempted: %+v", stats)
+	}
+	// замена ключа устройства новых ключей не добавляет
+	if _, err := p.GenerateE("0"); err != nil {
+		t.Error(err)
+	}
+	for _, fraction := range []float64{0, -1, 1.5} {
+		if _, err := New(WithMaxFill(fraction)); err == nil {
+			t.Errorf("fraction %v accepted", fraction)
+		}
+	}
+}
+
+// benchKeys задает количество уже выданных ключей, с которыми выполняются тесты
+// производительности.
+const benchKeys = 10000
+
+// benchPairs возвращает список ключей, заполненный benchKeys действующими ключами.
+func benchPairs(b *testing.B) *Pairs {
+	p := mustNew(b, WithInitialCapacity(2*benchKeys))
+	if _, err := p.GenerateN("existing", benchKeys); err != nil {
+		b.Fatal(err)
+	}
+	return p
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	p := benchPairs(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Generate("device")
+	}
+}
+
+func BenchmarkGetDeviceID(b *testing.B) {
+	p := benchPairs(b)
+	keys, err := p.GenerateN("device", b.N)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, key := range keys {
+		if p.GetDeviceID(key) == "" {
+			b.Fatal("key not found")
+		}
+	}
+}
+
+func BenchmarkGenerateParallel(b *testing.B) {
+	p := benchPairs(b)
+	var counter int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			// каждая генерация для нового устройства, поэтому потоки конкурируют за блокировку
+			p.Generate(strconv.FormatInt(atomic.AddInt64(&counter, 1), 10))
+		}
+	})
+}
+
+func TestLookup(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(time.Minute), WithClock(clock.Now))
+	key := p.Generate("device")
+	old := p.GenerateWithExpire("expired", time.Second)
+	clock.Advance(time.Second)
+	if id, status := p.Lookup(old); id != "" || status != Expired {
+		t.Errorf("unexpected result for expired key: %q %v", id, status)
+	}
+	if id, status := p.Lookup(key); id != "device" || status != Valid {
+		t.Errorf("unexpected result for valid key: %q %v", id, status)
+	}
+	for _, key := range []string{key, old, "unknown"} {
+		if id, status := p.Lookup(key); id != "" || status != NotFound {
+			t.Errorf("unexpected result for %q: %q %v", key, id, status)
+		}
+	}
+	if Expired.String() != "expired" {
+		t.Errorf("unexpected name: %v", Expired)
+	}
+}
+
+func TestClose(t *testing.T) {
+	p := mustNew(t)
+	key := p.Generate("device")
+	events := p.Events()
+	p.StartJanitor(time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.GenerateE("other"); err != ErrClosed {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if p.GetDeviceID(key) != "" {
+		t.Error("key found after close")
+	}
+	for range events {
+	}
+	if _, ok := <-p.Events(); ok {
+		t.Error("events channel open after close")
+	}
+	p.StartJanitor(time.Millisecond)() // не должен запускаться
+}
+
+func TestGenerateInfo(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(time.Minute), WithClock(clock.Now))
+	key, issuedAt, expiresAt := p.GenerateInfo("device")
+	if key == "" || !issuedAt.Equal(clock.now) || !expiresAt.Equal(clock.now.Add(time.Minute)) {
+		t.Errorf("unexpected info: %q %v %v", key, issuedAt, expiresAt)
+	}
+	p = mustNew(t, WithRandSource(errReader{errors.New("read error")}))
+	if key, issuedAt, _ := p.GenerateInfo("device"); key != "" || !issuedAt.IsZero() {
+		t.Errorf("unexpected info on error: %q %v", key, issuedAt)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	p := mustNew(t)
+	key := p.Generate("device")
+	for i := 0; i < 2; i++ {
+		if id, ok := p.Resolve(key, false); !ok || id != "device" {
+			t.Fatalf("key not resolved: %q %v", id, ok)
+		}
+	}
+	if id, ok := p.Resolve(key, true); !ok || id != "device" {
+		t.Fatalf("key not consumed: %q %v", id, ok)
+	}
+	if _, ok := p.Resolve(key, false); ok {
+		t.Error("consumed key resolved")
+	}
+}
+
+func TestSetters(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithExpire(time.Minute), WithClock(clock.Now))
+	old := p.Generate("old")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.Generate(fmt.Sprint(i))
+		}
+	}()
+	p.SetExpire(time.Hour)
+	if err := p.SetLength(8); err != nil {
+		t.Error(err)
+	}
+	<-done
+	key := p.Generate("new")
+	if ttl, _ := p.TTL(old); ttl != time.Minute {
+		t.Errorf("old key ttl changed: %v", ttl)
+	}
+	if ttl, _ := p.TTL(key); ttl != time.Hour || len(key) != 8 {
+		t.Errorf("new settings not applied: %q %v", key, ttl)
+	}
+}
+
+func TestReadLock(t *testing.T) {
+	p := mustNew(t)
+	key := p.Generate("device")
+	// поиск неизвестного ключа и проверки без использования не ждут блокировки на запись
+	p.mu.RLock()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.GetDeviceID("UNKNOWN")
+		p.Peek(key)
+		p.TTL(key)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("read blocked by another reader")
+	}
+	p.mu.RUnlock()
+	<-done
+	// после повторной проверки под блокировкой на запись ключ используется только один раз
+	var (
+		wg    sync.WaitGroup
+		found int32
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if p.GetDeviceID(key) != "" {
+				atomic.AddInt32(&found, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if found != 1 {
+		t.Errorf("key consumed %d times", found)
+	}
+}
+
+func TestAssign(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithGrouping(3, "-"))
+	if err := p.Assign("device", "OLD-KEY"); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := p.Peek("OLDKEY"); !ok || id != "device" {
+		t.Errorf("assigned key not found: %q", id)
+	}
+	if err := p.Assign("other", "OLDKEY"); err != ErrKeyInUse {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.Assign("", "key"); err != ErrEmptyDeviceID {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := p.Assign("other", "-"); err == nil {
+		t.Error("empty key assigned")
+	}
+	// ключ устройства заменяется, а просроченный ключ можно назначить другому устройству
+	if err := p.Assign("device", "NEWKEY"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.Peek("OLDKEY"); ok {
+		t.Error("old key not replaced")
+	}
+	clock.Advance(time.Minute)
+	if err := p.Assign("other", "NEWKEY"); err != nil {
+		t.Fatal(err)
+	}
+	if id := p.GetDeviceID("NEW-KEY"); id != "other" {
+		t.Errorf("unexpected device: %q", id)
+	}
+	if _, _, ok := p.HasDevice("device"); ok {
+		t.Error("expired key still assigned to old device")
+	}
+}
+
+func TestEntropyBits(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(4), WithChecksum())
+	if bits := p.EntropyBits(); math.Abs(bits-4*math.Log2(10)) > 1e-9 {
+		t.Errorf("unexpected entropy: %v", bits)
+	}
+}
+
+func TestGenerateMultiUse(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithRedeemGrace(time.Minute))
+	key := p.GenerateMultiUse("kiosk", 3)
+	for i := 0; i < 3; i++ {
+		if id := p.GetDeviceID(key); id != "kiosk" {
+			t.Fatalf("use %d failed: %q", i+1, id)
+		}
+	}
+	if _, status := p.Lookup(key); status != Redeemed {
+		t.Errorf("unexpected status after last use: %v", status)
+	}
+	if s := p.Stats(); s.Consumed != 3 {
+		t.Errorf("unexpected consumed count: %d", s.Consumed)
+	}
+	key = p.GenerateMultiUse("kiosk", 2)
+	p.GetDeviceID(key)
+	clock.Advance(time.Minute)
+	if _, status := p.Lookup(key); status != Expired {
+		t.Errorf("multi-use key not expired: %v", status)
+	}
+	if key := p.GenerateMultiUse("kiosk", 0); key != "" {
+		t.Errorf("key generated without uses: %q", key)
+	}
+	// в режиме нескольких ключей другие ключи устройства сохраняются
+	p = mustNew(t, WithMultiKey())
+	single := p.Generate("device")
+	multi := p.GenerateMultiUse("device", 2)
+	p.GetDeviceID(multi)
+	if _, ok := p.Peek(single); !ok {
+		t.Error("other key removed")
+	}
+	if id := p.GetDeviceID(multi); id != "device" {
+		t.Errorf("second use failed: %q", id)
+	}
+}
+
+// failStore возвращает ошибку при сохранении ключа, если она задана.
+type failStore struct {
+	Store
+	err error
+}
+
+func (s *failStore) Put(kInfo StoreRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.Store.Put(kInfo)
+}
+
+func TestGenerateMultiUseReuse(t *testing.T) {
+	p := mustNew(t, WithReuseValid())
+	key := p.GenerateMultiUse("kiosk", 3)
+	p.GetDeviceID(key)
+	if again := p.GenerateMultiUse("kiosk", 5); again != key {
+		t.Fatalf("valid key not reused: %q != %q", again, key)
+	}
+	for i := 0; i < 2; i++ {
+		if id := p.GetDeviceID(key); id != "kiosk" {
+			t.Fatalf("use %d failed: %q", i+2, id)
+		}
+	}
+	if _, status := p.Lookup(key); status != NotFound {
+		t.Errorf("use counter reset on reuse: %v", status)
+	}
+	// одноразовый ключ остается одноразовым
+	p = mustNew(t, WithPerDeviceCooldown(time.Minute))
+	key = p.Generate("device")
+	if again := p.GenerateMultiUse("device", 3); again != key {
+		t.Fatalf("key replaced during cooldown: %q != %q", again, key)
+	}
+	p.GetDeviceID(key)
+	if id := p.GetDeviceID(key); id != "" {
+		t.Errorf("single-use key consumed twice by %q", id)
+	}
+}
+
+func TestGenerateMultiUseSaveError(t *testing.T) {
+	store := &failStore{Store: newMemStore(0)}
+	p := mustNew(t, WithStore(store))
+	old := p.Generate("kiosk")
+	store.err = errors.New("store unavailable")
+	if key := p.GenerateMultiUse("kiosk", 3); key != "" {
+		t.Errorf("key issued despite save error: %q", key)
+	}
+	store.err = nil
+	if id := p.GetDeviceID(old); id != "kiosk" {
+		t.Errorf("old key lost after save error: %q", id)
+	}
+}
+
+func TestGetDeviceIDMinTTL(t *testing.T) {
+	clock := newFakeClock()
+	var expired int
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute))
+	p.OnExpire = func(string, string) { expired++ }
+	key := p.Generate("device")
+	clock.Advance(50 * time.Second)
+	if id := p.GetDeviceIDMinTTL(key, 15*time.Second); id != "" {
+		t.Errorf("key near expiry consumed by %q", id)
+	}
+	if _, ok := p.Peek(key); ok || expired != 1 {
+		t.Errorf("key near expiry not removed: %d", expired)
+	}
+	key = p.Generate("device")
+	if id := p.GetDeviceIDMinTTL(key, 15*time.Second); id != "device" {
+		t.Errorf("unexpected device %q", id)
+	}
+	if id := p.GetDeviceIDMinTTL(key, 0); id != "" {
+		t.Error("key consumed twice")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	p := mustNew(t)
+	key := p.Generate("device")
+	if !p.Verify(key, "device") {
+		t.Error("valid key not verified")
+	}
+	if p.Verify(key, "other") || p.Verify(key, "") || p.Verify("unknown", "device") {
+		t.Error("wrong key or device verified")
+	}
+	if id := p.GetDeviceID(key); id != "device" {
+		t.Errorf("key consumed by Verify: %q", id)
+	}
+	if p.Verify(key, "device") {
+		t.Error("consumed key verified")
+	}
+}
+
+func TestRevokePrefix(t *testing.T) {
+	p := mustNew(t, WithMultiKey())
+	kept := p.Generate("tenant1:dev")
+	for _, deviceID := range []string{"tenant42:a", "tenant42:b", "tenant42:b"} {
+		p.Generate(deviceID)
+	}
+	if n := p.RevokePrefix(""); n != 0 {
+		t.Errorf("empty prefix revoked %d keys", n)
+	}
+	if n := p.RevokePrefix("tenant42:"); n != 3 {
+		t.Errorf("revoked %d keys", n)
+	}
+	if _, _, ok := p.HasDevice("tenant42:b"); ok {
+		t.Error("device key not revoked")
+	}
+	if id, ok := p.Peek(kept); !ok || id != "tenant1:dev" || p.Len() != 1 {
+		t.Error("other tenant keys revoked")
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1), WithMaxIter(5),
+		WithKeyFunc(func(uint8) string { return "7" }))
+	p.Generate("first")
+	_, err := p.GenerateE("second")
+	var genErr *GenerateError
+	if !errors.As(err, &genErr) || !errors.Is(err, ErrKeySpaceExhausted) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if genErr.Attempts != 5 || genErr.KeySpaceSize != 10 || genErr.LiveCount != 1 {
+		t.Errorf("unexpected error details: %+v", genErr)
+	}
+}
+
+func TestKeyForDevice(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithGrouping(3, "-"))
+	key := p.Generate("device")
+	if got, ok := p.KeyForDevice("device"); !ok || got != key {
+		t.Errorf("unexpected key: %q", got)
+	}
+	if _, ok := p.KeyForDevice("unknown"); ok {
+		t.Error("key for unknown device")
+	}
+	if id, ok := p.Peek(key); !ok || id != "device" {
+		t.Error("key consumed")
+	}
+	clock.Advance(time.Minute)
+	if _, ok := p.KeyForDevice("device"); ok {
+		t.Error("expired key revealed")
+	}
+	q := mustNew(t, WithHashedKeys([]byte("secret")))
+	q.Generate("device")
+	if _, ok := q.KeyForDevice("device"); ok {
+		t.Error("hashed key revealed")
+	}
+}
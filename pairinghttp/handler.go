@@ -0,0 +1,189 @@
+// Package pairinghttp предоставляет HTTP-обработчик для генерации и использования ключей
+// спаривания устройств. Вынесен в отдельный пакет, чтобы основной пакет pairing не зависел от
+// net/http.
+//
+// Обработчик поддерживает два запроса, оба методом POST с телом в формате JSON:
+//
+//	POST /generate {"device_id": "..."} → {"key": "..."}
+//	POST /redeem   {"key": "..."}       → {"device_id": "..."}
+//
+// При ошибке возвращается соответствующий код состояния HTTP и тело вида {"error": "..."}.
+// Проверка подлинности и прав доступа не выполняется и должна обеспечиваться промежуточными
+// обработчиками.
+package pairinghttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/geotrace/pairing"
+)
+
+// maxBodySize задает максимальный размер тела запроса.
+const maxBodySize = 4 << 10
+
+// Pairer описывает методы списка ключей, которые использует обработчик. Ему удовлетворяют как
+// *pairing.Pairs, так и *pairing.Sharded.
+type Pairer interface {
+	GenerateE(deviceID string) (string, error)
+	Lookup(key string) (string, pairing.Status)
+}
+
+// generateRequest описывает запрос на генерацию ключа.
+type generateRequest struct {
+	DeviceID string `json:"device_id"` // идентификатор устройства
+}
+
+// generateResponse описывает ответ со сгенерированным ключом.
+type generateResponse struct {
+	Key string `json:"key"` // ключ
+}
+
+// redeemRequest описывает запрос на использование ключа.
+type redeemRequest struct {
+	Key string `json:"key"` // ключ
+}
+
+// redeemResponse описывает ответ с идентификатором устройства.
+type redeemResponse struct {
+	DeviceID string `json:"device_id"` // идентификатор устройства
+}
+
+// errorResponse описывает ответ с ошибкой.
+type errorResponse struct {
+	Error string `json:"error"` // описание ошибки
+}
+
+// config содержит параметры обработчика.
+type config struct {
+	logger pairing.Logger // журнал внутренних ошибок
+}
+
+// Option задает параметр обработчика.
+type Option func(*config)
+
+// WithLogger задает журнал, в который записываются внутренние ошибки, текст которых не
+// передается клиенту. По умолчанию ошибки не записываются.
+func WithLogger(logger pairing.Logger) Option {
+	return func(c *config) {
+		if logger != nil {
+			c.logger = logger
+		}
+	}
+}
+
+// nopLogger описывает журнал по умолчанию, который ничего не выводит.
+type nopLogger struct{}
+
+// Printf ничего не делает.
+func (nopLogger) Printf(string, ...interface{}) {}
+
+// Handler возвращает обработчик запросов /generate и /redeem для списка ключей p.
+//
+// Генерация возвращает 400 для пустого или слишком длинного идентификатора устройства, 409, если
+// действующий ключ устройства нельзя заменить, 503, если уникальный ключ сгенерировать не
+// удалось, достигнуто ограничение MaxActive или список закрыт, и 500 для остальных ошибок. Текст
+// остальных ошибок записывается в журнал, заданный WithLogger, а клиенту возвращается только
+// описание кода.
+//
+// Использование ключа возвращает 404 для неизвестного ключа, 410 для ключа, время жизни которого
+// истекло, 409 для уже использованного ключа, который запоминается с WithRedeemGrace, и 400 для
+// ключа с неверным контрольным символом. Ключ при успешном использовании удаляется.
+//
+// Для запросов с другими методами возвращается 405, а для неверного тела запроса — 400.
+func Handler(p Pairer, opts ...Option) http.Handler {
+	c := config{logger: nopLogger{}}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/generate", post(func(w http.ResponseWriter, r *http.Request) {
+		var req generateRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		key, err := p.GenerateE(req.DeviceID)
+		if err != nil {
+			code := generateStatus(err)
+			msg := err.Error()
+			if code == http.StatusInternalServerError {
+				// подробности внутренней ошибки, например, хранилища, клиенту не передаются
+				c.logger.Printf("pairinghttp: generate: %v", err)
+				msg = http.StatusText(code)
+			}
+			writeError(w, code, msg)
+			return
+		}
+		writeJSON(w, http.StatusOK, generateResponse{Key: key})
+	}))
+	mux.HandleFunc("/redeem", post(func(w http.ResponseWriter, r *http.Request) {
+		var req redeemRequest
+		if !decode(w, r, &req) {
+			return
+		}
+		deviceID, status := p.Lookup(req.Key)
+		switch status {
+		case pairing.Valid:
+			writeJSON(w, http.StatusOK, redeemResponse{DeviceID: deviceID})
+		case pairing.Expired:
+			writeError(w, http.StatusGone, status.String())
+		case pairing.Redeemed:
+			writeError(w, http.StatusConflict, status.String())
+		case pairing.BadChecksum:
+			writeError(w, http.StatusBadRequest, status.String())
+		default:
+			writeError(w, http.StatusNotFound, pairing.NotFound.String())
+		}
+	}))
+	return mux
+}
+
+// generateStatus возвращает код состояния HTTP для ошибки генерации ключа.
+func generateStatus(err error) int {
+	switch {
+	case errors.Is(err, pairing.ErrEmptyDeviceID), errors.Is(err, pairing.ErrDeviceIDTooLong):
+		return http.StatusBadRequest
+	case errors.Is(err, pairing.ErrKeyStillValid):
+		return http.StatusConflict
+	case errors.Is(err, pairing.ErrKeySpaceExhausted), errors.Is(err, pairing.ErrTooManyKeys),
+		errors.Is(err, pairing.ErrClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// post возвращает обработчик, который отвергает запросы с методом, отличным от POST.
+func post(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// decode разбирает тело запроса в формате JSON. При ошибке отправляет ответ 400 и возвращает
+// false.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "bad request body")
+		return false
+	}
+	return true
+}
+
+// writeError отправляет ответ с ошибкой.
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, errorResponse{Error: msg})
+}
+
+// writeJSON отправляет ответ в формате JSON.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
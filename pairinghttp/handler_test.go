@@ -0,0 +1,100 @@
+package pairinghttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/geotrace/pairing"
+)
+
+// do выполняет запрос к обработчику и возвращает код состояния и разобранное тело ответа.
+func do(t *testing.T, h http.Handler, method, path, body string) (int, map[string]string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	var resp map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return rec.Code, resp
+}
+
+func TestHandler(t *testing.T) {
+	now := time.Now()
+	p, err := pairing.New(pairing.WithClock(func() time.Time { return now }),
+		pairing.WithExpire(time.Minute), pairing.WithChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Handler(p)
+	code, resp := do(t, h, http.MethodPost, "/generate", `{"device_id":"device"}`)
+	if code != http.StatusOK || resp["key"] == "" {
+		t.Fatalf("generate: %d %v", code, resp)
+	}
+	key := resp["key"]
+	code, resp = do(t, h, http.MethodPost, "/redeem", `{"key":"`+key+`"}`)
+	if code != http.StatusOK || resp["device_id"] != "device" {
+		t.Errorf("redeem: %d %v", code, resp)
+	}
+	code, _ = do(t, h, http.MethodPost, "/redeem", `{"key":"`+key+`"}`)
+	if code != http.StatusNotFound {
+		t.Errorf("redeem twice: %d", code)
+	}
+	_, resp = do(t, h, http.MethodPost, "/generate", `{"device_id":"other"}`)
+	now = now.Add(time.Minute)
+	code, _ = do(t, h, http.MethodPost, "/redeem", `{"key":"`+resp["key"]+`"}`)
+	if code != http.StatusGone {
+		t.Errorf("redeem expired: %d", code)
+	}
+	for _, test := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/generate", `{"device_id":""}`, http.StatusBadRequest},
+		{http.MethodPost, "/generate", `{`, http.StatusBadRequest},
+		{http.MethodGet, "/generate", ``, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/redeem", `{"key":"AAAAAAA"}`, http.StatusBadRequest},
+	} {
+		code, resp = do(t, h, test.method, test.path, test.body)
+		if code != test.code || resp["error"] == "" {
+			t.Errorf("%s %s %s: %d %v", test.method, test.path, test.body, code, resp)
+		}
+	}
+	p.Close()
+	code, _ = do(t, h, http.MethodPost, "/generate", `{"device_id":"device"}`)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("generate after close: %d", code)
+	}
+}
+
+// failPairer возвращает заданную ошибку при генерации ключа.
+type failPairer struct{ err error }
+
+func (p failPairer) GenerateE(string) (string, error)       { return "", p.err }
+func (p failPairer) Lookup(string) (string, pairing.Status) { return "", pairing.NotFound }
+
+func TestHandlerInternalError(t *testing.T) {
+	var buf bytes.Buffer
+	h := Handler(failPairer{errors.New("redis: connection refused 10.0.0.1:6379")},
+		WithLogger(log.New(&buf, "", 0)))
+	code, resp := do(t, h, http.MethodPost, "/generate", `{"device_id":"device"}`)
+	if code != http.StatusInternalServerError || resp["error"] != http.StatusText(code) {
+		t.Errorf("unexpected response: %d %v", code, resp)
+	}
+	if !strings.Contains(buf.String(), "connection refused") {
+		t.Errorf("error not logged: %q", buf.String())
+	}
+	// без журнала ошибка не выводится
+	code, _ = do(t, Handler(failPairer{errors.New("failure")}), http.MethodPost, "/generate",
+		`{"device_id":"device"}`)
+	if code != http.StatusInternalServerError {
+		t.Errorf("unexpected code: %d", code)
+	}
+}
@@ -0,0 +1,45 @@
+//go:build prometheus
+// +build prometheus
+
+package pairing
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Collector возвращает сборщик метрик Prometheus для этого списка ключей: количество действующих
+// ключей, а так же счетчики сгенерированных ключей, совпадений при генерации, использованных и
+// устаревших ключей.
+//
+// Для сборки необходимо указать тег prometheus.
+func (p *Pairs) Collector() prometheus.Collector {
+	return &collector{
+		pairs:      p,
+		active:     prometheus.NewDesc("pairing_active_keys", "Number of live pairing keys.", nil, nil),
+		generated:  prometheus.NewDesc("pairing_generated_total", "Total number of generated keys.", nil, nil),
+		collisions: prometheus.NewDesc("pairing_collisions_total", "Total number of key generation retries due to collisions.", nil, nil),
+		consumed:   prometheus.NewDesc("pairing_consumed_total", "Total number of successfully consumed keys.", nil, nil),
+		expired:    prometheus.NewDesc("pairing_expired_total", "Total number of keys removed due to expiry.", nil, nil),
+	}
+}
+
+// collector описывает сборщик метрик Prometheus для списка ключей.
+type collector struct {
+	pairs                                            *Pairs
+	active, generated, collisions, consumed, expired *prometheus.Desc
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.active
+	ch <- c.generated
+	ch <- c.collisions
+	ch <- c.consumed
+	ch <- c.expired
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.pairs.Stats()
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(c.pairs.Len()))
+	ch <- prometheus.MustNewConstMetric(c.generated, prometheus.CounterValue, float64(stats.Generated))
+	ch <- prometheus.MustNewConstMetric(c.collisions, prometheus.CounterValue, float64(stats.Collisions))
+	ch <- prometheus.MustNewConstMetric(c.consumed, prometheus.CounterValue, float64(stats.Consumed))
+	ch <- prometheus.MustNewConstMetric(c.expired, prometheus.CounterValue, float64(stats.Expired))
+}
@@ -0,0 +1,61 @@
+package pairing
+
+import "time"
+
+// minRedeemedPrune задает минимальное количество запомненных использованных ключей, после
+// которого из справочника удаляются устаревшие.
+const minRedeemedPrune = 64
+
+// redemptions описывает недавно использованные ключи, которые запоминаются на время, заданное
+// WithRedeemGrace.
+type redemptions struct {
+	keys    map[string]StoreRecord // использованные ключи; Expires — окончание времени хранения
+	pruneAt int                    // размер справочника, при котором удаляются устаревшие ключи
+}
+
+// redeem запоминает использованный ключ, если задано WithRedeemGrace. Должна вызываться под
+// блокировкой.
+func (p *Pairs) redeem(kInfo StoreRecord) {
+	if p.grace <= 0 {
+		return
+	}
+	now := p.clock()
+	r := &p.redeemed
+	if r.keys == nil {
+		r.keys = make(map[string]StoreRecord)
+	}
+	if len(r.keys) >= r.pruneAt {
+		// устаревшие ключи удаляются, когда справочник вырастает вдвое, поэтому в среднем
+		// запоминание ключа занимает постоянное время даже без StartJanitor
+		r.prune(now)
+		r.pruneAt = 2 * len(r.keys)
+		if r.pruneAt < minRedeemedPrune {
+			r.pruneAt = minRedeemedPrune
+		}
+	}
+	r.keys[kInfo.Key] = StoreRecord{
+		DeviceID: kInfo.DeviceID,
+		Key:      kInfo.Key,
+		Time:     now,
+		Expires:  now.Add(p.grace),
+	}
+}
+
+// redemption возвращает информацию о недавно использованном ключе, если время его хранения еще
+// не истекло. Должна вызываться под блокировкой.
+func (p *Pairs) redemption(key string) (StoreRecord, bool) {
+	kInfo, ok := p.redeemed.keys[key]
+	if !ok || p.closed || p.expired(kInfo) {
+		return StoreRecord{}, false
+	}
+	return kInfo, true
+}
+
+// prune удаляет из справочника ключи, время хранения которых истекло.
+func (r *redemptions) prune(now time.Time) {
+	for key, kInfo := range r.keys {
+		if !now.Before(kInfo.Expires) {
+			delete(r.keys, key)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+//go:build redis
+// +build redis
+
+package pairing
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore описывает хранилище ключей в Redis, которое можно использовать совместно из
+// нескольких экземпляров сервиса.
+//
+// Для каждой привязки сохраняются две записи: хеш с информацией о ключе и строка с ключом для
+// устройства. Обе записи создаются со временем жизни, соответствующим сроку действия ключа,
+// поэтому устаревшие записи удаляет сам Redis. Удаление записей выполняется скриптами Lua, что
+// гарантирует согласованность обратной записи. Put не заменяет действующую запись ключа другого
+// устройства и возвращает ErrKeyInUse, поэтому два экземпляра не выдадут один ключ разным
+// устройствам.
+//
+// Для сборки необходимо указать тег redis.
+type RedisStore struct {
+	client redis.Cmdable // соединение с сервером
+	prefix string        // префикс имен записей
+}
+
+// NewRedisStore возвращает новое хранилище ключей в Redis, использующее указанное соединение.
+// Все имена записей начинаются с prefix, что позволяет хранить в одной базе данные нескольких
+// списков.
+func NewRedisStore(client redis.Cmdable, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Скрипты для атомарного изменения связанных записей.
+var (
+	// KEYS: запись ключа, запись устройства;
+	// ARGV: префикс записей ключей, префикс записей устройств, ключ, устройство, время генерации,
+	// время окончания действия, время жизни записи в миллисекундах и количество использований.
+	// Возвращает 0, если ключ выдан другому устройству и еще действует.
+	redisPut = redis.NewScript(`
+local dev = redis.call('HGET', KEYS[1], 'device')
+if dev and dev ~= ARGV[4] and
+	tonumber(redis.call('HGET', KEYS[1], 'expires')) > tonumber(ARGV[5]) then
+	return 0
+end
+local old = redis.call('GET', KEYS[2])
+if old then redis.call('DEL', ARGV[1] .. old) end
+if dev and redis.call('GET', ARGV[2] .. dev) == ARGV[3] then
+	redis.call('DEL', ARGV[2] .. dev)
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'device', ARGV[4], 'time', ARGV[5], 'expires', ARGV[6], 'uses', ARGV[8])
+redis.call('PEXPIRE', KEYS[1], ARGV[7])
+redis.call('SET', KEYS[2], ARGV[3], 'PX', ARGV[7])
+return 1`)
+	// KEYS: запись ключа; ARGV: префикс записей устройств, ключ.
+	redisDeleteByKey = redis.NewScript(`
+local dev = redis.call('HGET', KEYS[1], 'device')
+if not dev then return 0 end
+redis.call('DEL', KEYS[1])
+if redis.call('GET', ARGV[1] .. dev) == ARGV[2] then
+	redis.call('DEL', ARGV[1] .. dev)
+end
+return 1`)
+	// KEYS: запись ключа; ARGV: префикс записей устройств, ключ. Возвращает поля удаленного хеша.
+	redisTake = redis.NewScript(`
+local fields = redis.call('HGETALL', KEYS[1])
+if #fields == 0 then return fields end
+local dev = redis.call('HGET', KEYS[1], 'device')
+redis.call('DEL', KEYS[1])
+if redis.call('GET', ARGV[1] .. dev) == ARGV[2] then
+	redis.call('DEL', ARGV[1] .. dev)
+end
+return fields`)
+	// KEYS: запись устройства; ARGV: префикс записей ключей.
+	redisDeleteByDevice = redis.NewScript(`
+local key = redis.call('GET', KEYS[1])
+if not key then return 0 end
+redis.call('DEL', KEYS[1])
+redis.call('DEL', ARGV[1] .. key)
+return 1`)
+)
+
+// Clock возвращает функцию текущего времени, синхронизированную с часами сервера Redis, для
+// использования с WithClock. Смотри SyncedClock.
+func (s *RedisStore) Clock(ctx context.Context) (func() time.Time, error) {
+	now, err := s.client.Time(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	return SyncedClock(now), nil
+}
+
+func (s *RedisStore) keyName(key string) string         { return s.prefix + "key:" + key }
+func (s *RedisStore) deviceName(deviceID string) string { return s.prefix + "device:" + deviceID }
+
+func (s *RedisStore) Put(kInfo StoreRecord) error {
+	// время жизни записи вычисляется без локальных часов, которые могут расходиться с часами
+	// списка ключей
+	ttl := kInfo.Expires.Sub(kInfo.Time) / time.Millisecond
+	if ttl < 1 {
+		ttl = 1
+	}
+	n, err := redisPut.Run(context.Background(), s.client,
+		[]string{s.keyName(kInfo.Key), s.deviceName(kInfo.DeviceID)},
+		s.keyName(""), s.deviceName(""), kInfo.Key, kInfo.DeviceID,
+		kInfo.Time.UnixNano(), kInfo.Expires.UnixNano(), int64(ttl), kInfo.Uses).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrKeyInUse // ключ успел выдать другой экземпляр сервиса
+	}
+	return nil
+}
+
+func (s *RedisStore) GetByKey(key string) (StoreRecord, bool) {
+	kInfo, ok, _ := s.LookupKey(key)
+	return kInfo, ok
+}
+
+// LookupKey работает так же, как GetByKey, но возвращает ошибку обращения к Redis, чтобы
+// недоступность сервера не принималась за свободный ключ.
+func (s *RedisStore) LookupKey(key string) (StoreRecord, bool, error) {
+	fields, err := s.client.HGetAll(context.Background(), s.keyName(key)).Result()
+	if err != nil || len(fields) == 0 {
+		return StoreRecord{}, false, err
+	}
+	return parseKeyInfo(key, fields), true, nil
+}
+
+// Take атомарно удаляет записи о ключе и возвращает удаленную запись, поэтому из нескольких
+// экземпляров сервиса запись получает только один.
+func (s *RedisStore) Take(key string) (StoreRecord, bool) {
+	list, err := redisTake.Run(context.Background(), s.client,
+		[]string{s.keyName(key)}, s.deviceName(""), key).StringSlice()
+	if err != nil || len(list) == 0 {
+		return StoreRecord{}, false
+	}
+	fields := make(map[string]string, len(list)/2)
+	for i := 0; i+1 < len(list); i += 2 {
+		fields[list[i]] = list[i+1]
+	}
+	return parseKeyInfo(key, fields), true
+}
+
+// parseKeyInfo возвращает запись о ключе по полям хеша.
+func parseKeyInfo(key string, fields map[string]string) StoreRecord {
+	kInfo := StoreRecord{DeviceID: fields["device"], Key: key}
+	if nsec, err := strconv.ParseInt(fields["time"], 10, 64); err == nil {
+		kInfo.Time = time.Unix(0, nsec)
+	}
+	if nsec, err := strconv.ParseInt(fields["expires"], 10, 64); err == nil {
+		kInfo.Expires = time.Unix(0, nsec)
+	}
+	if uses, err := strconv.Atoi(fields["uses"]); err == nil {
+		kInfo.Uses = uses // в записях, созданных до появления поля, его нет
+	}
+	return kInfo
+}
+
+func (s *RedisStore) GetByDevice(deviceID string) (StoreRecord, bool) {
+	kInfo, ok, _ := s.LookupDevice(deviceID)
+	return kInfo, ok
+}
+
+// LookupDevice работает так же, как GetByDevice, но возвращает ошибку обращения к Redis.
+func (s *RedisStore) LookupDevice(deviceID string) (StoreRecord, bool, error) {
+	key, err := s.client.Get(context.Background(), s.deviceName(deviceID)).Result()
+	if err == redis.Nil {
+		return StoreRecord{}, false, nil
+	}
+	if err != nil {
+		return StoreRecord{}, false, err
+	}
+	kInfo, ok, err := s.LookupKey(key)
+	if err != nil || !ok || kInfo.DeviceID != deviceID {
+		return StoreRecord{}, false, err
+	}
+	return kInfo, true, nil
+}
+
+func (s *RedisStore) DeleteByKey(key string) bool {
+	n, err := redisDeleteByKey.Run(context.Background(), s.client,
+		[]string{s.keyName(key)}, s.deviceName(""), key).Int()
+	return err == nil && n == 1
+}
+
+func (s *RedisStore) DeleteByDevice(deviceID string) bool {
+	n, err := redisDeleteByDevice.Run(context.Background(), s.client,
+		[]string{s.deviceName(deviceID)}, s.keyName("")).Int()
+	return err == nil && n == 1
+}
+
+// Range перебирает записи с помощью команды SCAN, поэтому записи, добавленные или удаленные во
+// время перебора, могут как попасть, так и не попасть в него.
+func (s *RedisStore) Range(f func(kInfo StoreRecord) bool) {
+	ctx := context.Background()
+	prefix := s.keyName("")
+	iter := s.client.Scan(ctx, 0, prefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		if kInfo, ok := s.GetByKey(iter.Val()[len(prefix):]); ok && !f(kInfo) {
+			return
+		}
+	}
+}
@@ -0,0 +1,52 @@
+//go:build redis
+// +build redis
+
+package pairing
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Для выполнения теста необходимо указать адрес сервера Redis в переменной окружения REDIS_ADDR.
+func TestRedisStore(t *testing.T) {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_ADDR not set")
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	store := NewRedisStore(client, "pairing:test:")
+	p := mustNew(t, WithStore(store))
+	key := p.Generate("device")
+	if id, ok := p.Peek(key); !ok || id != "device" {
+		t.Fatalf("bad peek: %q %v", id, ok)
+	}
+	newKey := p.Generate("device")
+	if _, ok := store.GetByKey(key); ok {
+		t.Error("old key not removed")
+	}
+	if id := p.GetDeviceID(newKey); id != "device" {
+		t.Errorf("bad device id: %q", id)
+	}
+	if _, ok := store.GetByDevice("device"); ok {
+		t.Error("device record not removed")
+	}
+	// ключ, выданный другим экземпляром, не перезаписывается
+	now := time.Now()
+	first := StoreRecord{DeviceID: "a", Key: "SHARED", Time: now, Expires: now.Add(time.Minute)}
+	if err := store.Put(first); err != nil {
+		t.Fatal(err)
+	}
+	defer store.DeleteByKey("SHARED")
+	second := StoreRecord{DeviceID: "b", Key: "SHARED", Time: now, Expires: now.Add(time.Minute)}
+	if err := store.Put(second); err != ErrKeyInUse {
+		t.Errorf("live key overwritten: %v", err)
+	}
+	if kInfo, ok, err := store.LookupKey("SHARED"); err != nil || !ok || kInfo.DeviceID != "a" {
+		t.Errorf("bad record: %v %v %v", kInfo, ok, err)
+	}
+}
@@ -0,0 +1,64 @@
+package pairing
+
+import "strings"
+
+// UniquenessScope задает, в каких пределах выдаваемые ключи уникальны. Смотри
+// WithUniquenessScope.
+type UniquenessScope int
+
+// Области уникальности ключей.
+const (
+	Global    UniquenessScope = iota // ключи уникальны среди всех устройств
+	PerDevice                        // ключи уникальны только среди ключей одного устройства
+)
+
+// scopeSep отделяет идентификатор устройства от ключа в хранилище, если ключи уникальны только в
+// пределах устройства.
+const scopeSep = "\x00"
+
+// scoped возвращает значение, под которым нормализованный ключ устройства различается в
+// хранилище: сам ключ, а если ключи уникальны только в пределах устройства, то ключ вместе с
+// идентификатором устройства.
+func (p *Pairs) scoped(deviceID, key string) string {
+	if !p.perDevice {
+		return key
+	}
+	return deviceID + scopeSep + key
+}
+
+// unscoped возвращает ключ без идентификатора устройства, добавленного scoped.
+func (p *Pairs) unscoped(key string) string {
+	if !p.perDevice {
+		return key
+	}
+	return key[strings.LastIndex(key, scopeSep)+1:]
+}
+
+// LookupDevice работает так же, как Lookup, но ищет ключ только среди ключей указанного
+// устройства. Используется, если ключи уникальны только в пределах устройства, смотри
+// WithUniquenessScope, но работает и для уникальных среди всех устройств ключей. Действующий ключ
+// при этом используется и удаляется.
+func (p *Pairs) LookupDevice(deviceID, key string) Status {
+	if deviceID == "" {
+		return NotFound // пустой владелец означал бы любое устройство
+	}
+	key = p.canonical(key)
+	if p.checkKey(key) != nil {
+		return BadChecksum
+	}
+	_, status := p.lookup(key, p.storeKey(p.scoped(deviceID, key)), deviceID, 0)
+	return status
+}
+
+// verifyDevice возвращает true, если ключ действителен и выдан указанному устройству, не удаляя
+// запись о нем.
+func (p *Pairs) verifyDevice(deviceID, key string) bool {
+	key = p.canonical(key)
+	if p.checkKey(key) != nil {
+		return false
+	}
+	p.mu.RLock()
+	kInfo, ok := p.get(p.storeKey(p.scoped(deviceID, key)))
+	p.mu.RUnlock()
+	return ok && !p.expired(kInfo) && kInfo.DeviceID == deviceID
+}
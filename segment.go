@@ -0,0 +1,77 @@
+package pairing
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// SegmentedDictionary описывает словарь, в котором для разных позиций ключа используются разные
+// наборы символов: символ в позиции i выбирается из набора с номером i % len(d). Это позволяет,
+// например, чередовать согласные и гласные, чтобы ключи было легко произносить.
+type SegmentedDictionary []Dictionary
+
+// DictPronounceable чередует согласные и гласные буквы, что делает ключи произносимыми, например,
+// BATUKO. Каждая пара символов дает 80 вариантов, поэтому для той же неопределенности такие ключи
+// должны быть длиннее ключей из DictAlfa.
+var DictPronounceable = SegmentedDictionary{"BDFGHJKLMNPRSTVZ", "AEIOU"}
+
+// Validate проверяет, что словарь содержит хотя бы один набор символов, и каждый набор допустим.
+func (d SegmentedDictionary) Validate() error {
+	if len(d) == 0 {
+		return errors.New("pairing: пустой составной словарь")
+	}
+	for _, segment := range d {
+		if err := segment.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeySpace возвращает количество различных ключей заданной длины.
+func (d SegmentedDictionary) KeySpace(length uint8) float64 {
+	if len(d) == 0 {
+		return 0
+	}
+	size := 1.0
+	for i := 0; i < int(length); i++ {
+		size *= float64(d[i%len(d)].Len())
+	}
+	return size
+}
+
+// GenerateFrom возвращает случайный ключ заданной длины, используя в качестве источника
+// случайных данных src. Символы каждой позиции выбираются из ее набора равномерно.
+func (d SegmentedDictionary) GenerateFrom(src io.Reader, length uint8) (string, error) {
+	return d.GenerateInto(make([]rune, length), src)
+}
+
+// GenerateInto работает так же, как GenerateFrom, но заполняет случайными символами весь
+// переданный буфер buf и возвращает его содержимое в виде строки.
+func (d SegmentedDictionary) GenerateInto(buf []rune, src io.Reader) (string, error) {
+	if len(d) == 0 {
+		return "", ErrEmptyDictionary
+	}
+	for i := range buf {
+		if err := d[i%len(d)].fill(buf[i:i+1], src); err != nil {
+			return "", err
+		}
+	}
+	return string(buf), nil
+}
+
+// union возвращает словарь из всех символов всех наборов без повторов.
+func (d SegmentedDictionary) union() Dictionary {
+	var b strings.Builder
+	seen := make(map[rune]bool)
+	for _, segment := range d {
+		for _, r := range string(segment) {
+			if !seen[r] {
+				seen[r] = true
+				b.WriteRune(r)
+			}
+		}
+	}
+	return Dictionary(b.String())
+}
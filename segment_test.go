@@ -0,0 +1,30 @@
+package pairing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSegmentedDictionary(t *testing.T) {
+	p := mustNew(t, WithSegments(DictPronounceable), WithLength(6), WithCaseInsensitive())
+	for i := 0; i < 100; i++ {
+		key := p.Generate("device")
+		for pos, r := range key {
+			if !strings.ContainsRune(string(DictPronounceable[pos%2]), r) {
+				t.Fatalf("position %d of %q not from its segment", pos, key)
+			}
+		}
+	}
+	if size := DictPronounceable.KeySpace(6); size != 80*80*80 {
+		t.Errorf("unexpected key space %v", size)
+	}
+	if _, err := New(WithSegments(DictPronounceable), WithLength(2), WithMaxActive(81)); err == nil {
+		t.Error("key space not checked")
+	}
+	if _, err := New(WithSegments(SegmentedDictionary{"AB", ""})); err == nil {
+		t.Error("empty segment accepted")
+	}
+	if _, err := NewSharded(WithSegments(DictPronounceable)); err == nil {
+		t.Error("sharded segments accepted")
+	}
+}
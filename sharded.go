@@ -0,0 +1,441 @@
+package pairing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Sharded описывает список ключей для спаривания устройств, разделенный на несколько
+// независимых частей, каждая из которых имеет свою блокировку. Это позволяет одновременно
+// работать с ключами разных устройств без взаимной блокировки.
+//
+// Часть списка для устройства выбирается по хешу его идентификатора, а часть для ключа — по
+// номеру первого символа ключа в словаре. Чтобы обе записи о привязке всегда находились в одной
+// части и изменялись под одной блокировкой, первый символ ключа для устройства выбирается только
+// из символов, относящихся к его части. Поэтому ключи разных частей никогда не совпадают, а
+// проверять уникальность достаточно внутри одной части. Следует иметь в виду, что зная
+// идентификатор устройства, можно вычислить, из каких символов будет состоять начало его ключа,
+// поэтому при разделении на n частей неопределенность ключа уменьшается примерно на log2(n) бит.
+type Sharded struct {
+	shards []*Pairs
+}
+
+// shard описывает положение списка ключей в разделенном списке.
+type shard struct {
+	count int        // общее количество частей
+	first Dictionary // символы словаря, с которых могут начинаться ключи этой части
+}
+
+// generate возвращает случайный ключ длиной в буфер buf, относящийся к этой части списка.
+// Первый символ ключа выбирается из подмножества словаря этой части, а остальные — из всего
+// словаря dict.
+func (s *shard) generate(buf []rune, src io.Reader, dict Dictionary) (string, error) {
+	if len(buf) == 0 {
+		return "", nil
+	}
+	if err := s.first.fill(buf[:1], src); err != nil {
+		return "", err
+	}
+	if err := dict.fill(buf[1:], src); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// lockedReader описывает источник случайных данных, общий для всех частей списка. Каждая часть
+// читает его только под своей блокировкой, поэтому чтение дополнительно защищается общей.
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(b)
+}
+
+// shardIndex возвращает номер части для строки с помощью хеша FNV-1a.
+func shardIndex(s string, count int) int {
+	var h uint32 = 2166136261
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return int(h % uint32(count))
+}
+
+// NewSharded возвращает новый список ключей, разделенный на части. Количество частей задается
+// параметром WithShards, а по умолчанию равно 16, но не может превышать количество символов в
+// словаре. Остальные параметры применяются к каждой части, при этом ограничение MaxActive и
+// значение WithInitialCapacity делятся между ними поровну. Использование общего хранилища,
+// заданного WithStore, не поддерживается. Источник случайных данных, заданный WithRandSource, части
+// читают по очереди.
+func NewSharded(opts ...Option) (*Sharded, error) {
+	var config Pairs
+	for _, opt := range opts {
+		if err := opt(&config); err != nil {
+			return nil, err
+		}
+	}
+	if config.store != nil {
+		return nil, errors.New("pairing: разделенный список не поддерживает общее хранилище")
+	}
+	if config.segments != nil {
+		return nil, errors.New("pairing: разделенный список не поддерживает составной словарь")
+	}
+	if config.keyFunc != nil {
+		return nil, errors.New("pairing: разделенный список не поддерживает функцию генерации ключа")
+	}
+	var src io.Reader // источник, заданный WithRandSource, нужно защитить от одновременного чтения
+	if config.rand != nil {
+		src = &lockedReader{r: config.rand}
+	}
+	config.capacity = 0 // хранилище этого объекта не используется
+	config.init()
+	count := config.shards
+	if count == 0 {
+		count = 16
+	}
+	runes := []rune(string(config.Dictionary))
+	if count > len(runes) {
+		count = len(runes)
+	}
+	s := &Sharded{shards: make([]*Pairs, count)}
+	for i := range s.shards {
+		sh := &shard{count: count}
+		for j := i; j < len(runes); j += count {
+			sh.first += Dictionary(runes[j])
+		}
+		opts := append(opts[:len(opts):len(opts)], func(p *Pairs) error {
+			p.shard = sh
+			if src != nil {
+				p.rand = src
+			}
+			if p.MaxActive > 0 {
+				p.MaxActive = (p.MaxActive + count - 1) / count
+			}
+			if p.capacity > 0 {
+				p.capacity = (p.capacity + count - 1) / count
+			}
+			return nil
+		})
+		p, err := New(opts...)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = p
+	}
+	return s, nil
+}
+
+// forDevice возвращает часть списка для устройства.
+func (s *Sharded) forDevice(deviceID string) *Pairs {
+	return s.shards[shardIndex(deviceID, len(s.shards))]
+}
+
+// forKey возвращает часть списка для ключа. Ключи с неизвестным первым символом относятся к
+// первой части.
+func (s *Sharded) forKey(key string) *Pairs {
+	p := s.shards[0]
+	key = strings.TrimPrefix(p.canonical(key), p.canonicalPrefix()) // часть определяется без префикса
+	first, _ := utf8.DecodeRuneInString(key)
+	// словарь приводится к тому же виду, что и ключ, на случай, если регистр не учитывается
+	for i, r := range []rune(p.canonical(string(p.Dictionary))) {
+		if r == first {
+			return s.shards[i%len(s.shards)]
+		}
+	}
+	return p
+}
+
+// Generate возвращает новый уникальный ключ для спаривания устройства. Подробнее смотри
+// Pairs.Generate.
+func (s *Sharded) Generate(deviceID string) string {
+	return s.forDevice(deviceID).Generate(deviceID)
+}
+
+// GenerateE возвращает новый уникальный ключ для спаривания устройства или ошибку. Подробнее
+// смотри Pairs.GenerateE.
+func (s *Sharded) GenerateE(deviceID string) (string, error) {
+	return s.forDevice(deviceID).GenerateE(deviceID)
+}
+
+// GenerateContext возвращает новый уникальный ключ для спаривания устройства, учитывая
+// контекст. Подробнее смотри Pairs.GenerateContext.
+func (s *Sharded) GenerateContext(ctx context.Context, deviceID string) (string, error) {
+	return s.forDevice(deviceID).GenerateContext(ctx, deviceID)
+}
+
+// GenerateWithExpire возвращает новый ключ для устройства с собственным временем жизни. Подробнее
+// смотри Pairs.GenerateWithExpire.
+func (s *Sharded) GenerateWithExpire(deviceID string, exp time.Duration) string {
+	return s.forDevice(deviceID).GenerateWithExpire(deviceID, exp)
+}
+
+// GenerateInfo возвращает новый ключ для устройства вместе со временем его выдачи и окончания
+// действия. Подробнее смотри Pairs.GenerateInfo.
+func (s *Sharded) GenerateInfo(deviceID string) (string, time.Time, time.Time) {
+	return s.forDevice(deviceID).GenerateInfo(deviceID)
+}
+
+// Rotate генерирует новый ключ для устройства и возвращает его вместе с замененным ключом.
+// Подробнее смотри Pairs.Rotate.
+func (s *Sharded) Rotate(deviceID string) (newKey, oldKey string) {
+	return s.forDevice(deviceID).Rotate(deviceID)
+}
+
+// Assign сохраняет для устройства заданный ключ. Так как обе записи о привязке должны находиться
+// в одной части списка, ключ можно назначить только устройству, относящемуся к той же части, что
+// и первый символ ключа; иначе возвращается ошибка. Подробнее смотри Pairs.Assign.
+func (s *Sharded) Assign(deviceID, key string) error {
+	p := s.forDevice(deviceID)
+	if s.forKey(key) != p {
+		return errors.New("pairing: ключ не относится к части списка для устройства")
+	}
+	return p.Assign(deviceID, key)
+}
+
+// GetDeviceID возвращает идентификатор устройства по ключу и удаляет запись о нем. Подробнее
+// смотри Pairs.GetDeviceID.
+func (s *Sharded) GetDeviceID(key string) string {
+	return s.forKey(key).GetDeviceID(key)
+}
+
+// GenerateMultiUse генерирует ключ, который можно использовать несколько раз. Подробнее смотри
+// Pairs.GenerateMultiUse.
+func (s *Sharded) GenerateMultiUse(deviceID string, maxUses int) string {
+	return s.forDevice(deviceID).GenerateMultiUse(deviceID, maxUses)
+}
+
+// GetDeviceIDMinTTL возвращает идентификатор устройства по ключу, срок действия которого
+// истекает не раньше чем через min, и удаляет запись о нем. Подробнее смотри
+// Pairs.GetDeviceIDMinTTL.
+func (s *Sharded) GetDeviceIDMinTTL(key string, min time.Duration) string {
+	return s.forKey(key).GetDeviceIDMinTTL(key, min)
+}
+
+// Resolve возвращает идентификатор устройства по ключу, удаляя запись о нем, если consume
+// установлен. Подробнее смотри Pairs.Resolve.
+func (s *Sharded) Resolve(key string, consume bool) (string, bool) {
+	return s.forKey(key).Resolve(key, consume)
+}
+
+// Lookup возвращает идентификатор устройства и состояние ключа, удаляя запись о нем. Подробнее
+// смотри Pairs.Lookup.
+func (s *Sharded) Lookup(key string) (string, Status) {
+	return s.forKey(key).Lookup(key)
+}
+
+// LookupDevice использует ключ, выданный указанному устройству, и возвращает его состояние.
+// Подробнее смотри Pairs.LookupDevice.
+func (s *Sharded) LookupDevice(deviceID, key string) Status {
+	return s.forDevice(deviceID).LookupDevice(deviceID, key)
+}
+
+// Peek возвращает идентификатор устройства по ключу без удаления записи. Подробнее смотри
+// Pairs.Peek.
+func (s *Sharded) Peek(key string) (string, bool) {
+	return s.forKey(key).Peek(key)
+}
+
+// Verify проверяет, что ключ действителен и выдан указанному устройству, не удаляя его.
+// Подробнее смотри Pairs.Verify.
+func (s *Sharded) Verify(key, expectedDeviceID string) bool {
+	return s.forDevice(expectedDeviceID).Verify(key, expectedDeviceID)
+}
+
+// Inspect возвращает информацию о действующем ключе, не удаляя его. Подробнее смотри
+// Pairs.Inspect.
+func (s *Sharded) Inspect(key string) (PairInfo, bool) {
+	return s.forKey(key).Inspect(key)
+}
+
+// TTL возвращает оставшееся время жизни ключа. Подробнее смотри Pairs.TTL.
+func (s *Sharded) TTL(key string) (time.Duration, bool) {
+	return s.forKey(key).TTL(key)
+}
+
+// KeyForDevice возвращает действующий ключ устройства, не используя его. Подробнее смотри
+// Pairs.KeyForDevice.
+func (s *Sharded) KeyForDevice(deviceID string) (string, bool) {
+	return s.forDevice(deviceID).KeyForDevice(deviceID)
+}
+
+// DeviceGenCount возвращает количество попыток генерации ключа для устройства за последнее
+// время. Подробнее смотри Pairs.DeviceGenCount.
+func (s *Sharded) DeviceGenCount(deviceID string) int {
+	return s.forDevice(deviceID).DeviceGenCount(deviceID)
+}
+
+// Touch продлевает время жизни ключа. Подробнее смотри Pairs.Touch.
+func (s *Sharded) Touch(key string) bool {
+	return s.forKey(key).Touch(key)
+}
+
+// Revoke удаляет ключ, выданный для устройства. Подробнее смотри Pairs.Revoke.
+func (s *Sharded) Revoke(deviceID string) bool {
+	return s.forDevice(deviceID).Revoke(deviceID)
+}
+
+// RevokePrefix удаляет ключи всех устройств с идентификаторами, начинающимися с prefix, во всех
+// частях списка. Части обрабатываются по очереди. Подробнее смотри Pairs.RevokePrefix.
+func (s *Sharded) RevokePrefix(prefix string) (count int) {
+	for _, p := range s.shards {
+		count += p.RevokePrefix(prefix)
+	}
+	return
+}
+
+// RevokeKey удаляет ключ и запись об устройстве. Подробнее смотри Pairs.RevokeKey.
+func (s *Sharded) RevokeKey(key string) bool {
+	return s.forKey(key).RevokeKey(key)
+}
+
+// Len возвращает общее количество действующих ключей во всех частях списка. Части
+// просматриваются по очереди, поэтому при одновременном изменении списка результат является
+// приблизительным.
+func (s *Sharded) Len() (count int) {
+	for _, p := range s.shards {
+		count += p.Len()
+	}
+	return
+}
+
+// MemStats возвращает суммарные количество записей и объем памяти для всех частей списка. Части
+// просматриваются по очереди. Подробнее смотри Pairs.MemStats.
+func (s *Sharded) MemStats() (stats MemStats) {
+	for _, p := range s.shards {
+		shard := p.MemStats()
+		stats.Live += shard.Live
+		stats.Expired += shard.Expired
+		stats.Bytes += shard.Bytes
+	}
+	return
+}
+
+// SetExpire изменяет время жизни новых ключей во всех частях списка. Подробнее смотри
+// Pairs.SetExpire.
+func (s *Sharded) SetExpire(d time.Duration) {
+	for _, p := range s.shards {
+		p.SetExpire(d)
+	}
+}
+
+// SetLength изменяет длину новых ключей во всех частях списка. Подробнее смотри Pairs.SetLength.
+func (s *Sharded) SetLength(length uint8) error {
+	for _, p := range s.shards {
+		if err := p.SetLength(length); err != nil {
+			return err // ограничение длины одинаково во всех частях, поэтому ошибка будет у первой
+		}
+	}
+	return nil
+}
+
+// ExpiresFrom возвращает время окончания действия ключа, выданного в момент issuedAt по часам
+// сервера. Подробнее смотри Pairs.ExpiresFrom.
+func (s *Sharded) ExpiresFrom(issuedAt time.Time) time.Time {
+	return s.shards[0].ExpiresFrom(issuedAt) // время жизни одинаково во всех частях
+}
+
+// Config возвращает действующие параметры генерации ключей. Параметры всех частей совпадают,
+// кроме MaxActive, который возвращается суммарным для всех частей. Подробнее смотри Pairs.Config.
+func (s *Sharded) Config() Config {
+	c := s.shards[0].Config()
+	c.MaxActive *= len(s.shards)
+	return c
+}
+
+// EntropyBits возвращает неопределенность новых ключей в битах с учетом того, что первый символ
+// ключа зависит от части списка. Подробнее смотри Pairs.EntropyBits.
+func (s *Sharded) EntropyBits() float64 {
+	bits := s.shards[0].EntropyBits()
+	for _, p := range s.shards[1:] {
+		// части с меньшим набором первых символов имеют меньшую неопределенность
+		bits = math.Min(bits, p.EntropyBits())
+	}
+	return bits
+}
+
+// Reset удаляет все ключи и обнуляет статистику во всех частях списка. Подробнее смотри
+// Pairs.Reset.
+func (s *Sharded) Reset() {
+	for _, p := range s.shards {
+		p.Reset()
+	}
+}
+
+// Snapshot возвращает копию информации о действующих ключах всех частей списка. Копия каждой
+// части согласована, но части копируются по очереди. Подробнее смотри Pairs.Snapshot.
+func (s *Sharded) Snapshot() (snapshot []KeyInfo) {
+	for _, p := range s.shards {
+		snapshot = append(snapshot, p.Snapshot()...)
+	}
+	return
+}
+
+// Range вызывает f для каждого действующего ключа во всех частях списка. Части перебираются по
+// очереди, поэтому снимок не является единым для всего списка. Подробнее смотри Pairs.Range.
+func (s *Sharded) Range(f func(deviceID, key string, age time.Duration) bool) {
+	next := true
+	for _, p := range s.shards {
+		p.Range(func(deviceID, key string, age time.Duration) bool {
+			next = f(deviceID, key, age)
+			return next
+		})
+		if !next {
+			return
+		}
+	}
+}
+
+// RangeInfo вызывает f для описания каждого действующего ключа во всех частях списка. Части
+// перебираются по очереди. Подробнее смотри Pairs.RangeInfo.
+func (s *Sharded) RangeInfo(f func(info KeyInfo) bool) {
+	next := true
+	for _, p := range s.shards {
+		p.RangeInfo(func(info KeyInfo) bool {
+			next = f(info)
+			return next
+		})
+		if !next {
+			return
+		}
+	}
+}
+
+// StartJanitor запускает фоновую очистку устаревших ключей во всех частях списка. Подробнее
+// смотри Pairs.StartJanitor.
+func (s *Sharded) StartJanitor(interval time.Duration) (stop func()) {
+	stops := make([]func(), len(s.shards))
+	for i, p := range s.shards {
+		stops[i] = p.StartJanitor(interval)
+	}
+	return func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+}
+
+// Compact пересоздает справочники хранилищ всех частей списка. Части сжимаются по очереди, поэтому
+// одновременно блокируется только одна из них. Подробнее смотри Pairs.Compact.
+func (s *Sharded) Compact() {
+	for _, p := range s.shards {
+		p.Compact()
+	}
+}
+
+// Close закрывает все части списка. Подробнее смотри Pairs.Close.
+func (s *Sharded) Close() error {
+	for _, p := range s.shards {
+		p.Close()
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSharded(t *testing.T) {
+	s, err := NewSharded(WithShards(4), WithGrouping(3, "-"),
+		WithDictionary("abcdefghijklmnopqrstuvwxyz"), WithCaseInsensitive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		deviceID := fmt.Sprint(i)
+		keys[deviceID] = s.Generate(deviceID)
+	}
+	if n := s.Len(); n != 100 {
+		t.Errorf("bad len: %d", n)
+	}
+	// ключ и устройство должны находиться в одной части списка
+	for deviceID, key := range keys {
+		if s.forDevice(deviceID) != s.forKey(key) {
+			t.Fatalf("device %q and key %q in different shards", deviceID, key)
+		}
+	}
+	for deviceID, key := range keys {
+		if id := s.GetDeviceID(key); id != deviceID {
+			t.Errorf("bad device for %q: %q", key, id)
+		}
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("bad len: %d", n)
+	}
+	if _, err := NewSharded(WithStore(newMemStore(0))); err == nil {
+		t.Error("shared store accepted")
+	}
+	if _, err := New(WithShards(4)); err == nil {
+		t.Error("shards accepted by New")
+	}
+}
+
+func TestShardedRandSource(t *testing.T) {
+	// источник не допускает одновременного чтения, поэтому гонку обнаружит go test -race
+	s, err := NewSharded(WithShards(4), WithRandSource(rand.New(rand.NewSource(1))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, err := s.GenerateE(fmt.Sprint(i, "-", j)); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestShardedEntropyBits(t *testing.T) {
+	// 10 символов на 4 части: первые две части получают по 3 символа, остальные — по 2
+	s, err := NewSharded(WithDictionary(DictNum), WithLength(4), WithShards(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits, want := s.EntropyBits(), 1+3*math.Log2(10); math.Abs(bits-want) > 1e-9 {
+		t.Errorf("unexpected entropy: %v, want %v", bits, want)
+	}
+}
+
+func TestShardedSmall(t *testing.T) {
+	// количество частей не может превышать количество символов словаря
+	s, err := NewSharded(WithShards(16), WithDictionary(DictNumber), WithLength(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.shards) != 10 {
+		t.Fatalf("bad shard count: %d", len(s.shards))
+	}
+	for i := 0; i < 20; i++ {
+		deviceID := fmt.Sprint(i)
+		key, err := s.GenerateE(deviceID)
+		if errors.Is(err, ErrKeySpaceExhausted) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id, ok := s.Peek(key); !ok || id != deviceID {
+			t.Errorf("bad device for %q: %q", key, id)
+		}
+	}
+}
+
+func BenchmarkPairsParallel(b *testing.B) {
+	p, _ := New()
+	benchmarkParallel(b, p.Generate, p.GetDeviceID)
+}
+
+func BenchmarkShardedParallel(b *testing.B) {
+	s, _ := NewSharded()
+	benchmarkParallel(b, s.Generate, s.GetDeviceID)
+}
+
+func benchmarkParallel(b *testing.B, generate, get func(string) string) {
+	var counter int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			get(generate(fmt.Sprint(atomic.AddInt64(&counter, 1))))
+		}
+	})
+}
+
+func TestShardedUnicode(t *testing.T) {
+	s, err := NewSharded(WithShards(3), WithDictionary("абвгдеёжз"), WithCaseInsensitive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 30; i++ {
+		deviceID := fmt.Sprint(i)
+		key := s.Generate(deviceID)
+		if s.forDevice(deviceID) != s.forKey(key) {
+			t.Fatalf("device %q and key %q in different shards", deviceID, key)
+		}
+	}
+}
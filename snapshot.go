@@ -0,0 +1,109 @@
+package pairing
+
+import (
+	"strings"
+	"time"
+)
+
+// KeyInfo описывает выданный ключ для служебных интерфейсов администратора, а не для передачи
+// клиентам. Возвращается по значению и является копией записи хранилища, поэтому его изменение
+// не влияет на список ключей. Поля описаны тегами для представления в формате JSON.
+type KeyInfo struct {
+	DeviceID  string    `json:"device_id"`  // идентификатор устройства
+	Key       string    `json:"key"`        // ключ в виде для вывода, возможно, маскированный
+	IssuedAt  time.Time `json:"issued_at"`  // время выдачи или последнего продления ключа
+	ExpiresAt time.Time `json:"expires_at"` // время окончания действия ключа
+}
+
+// PairSnapshot описывает состояние одного выданного ключа, возвращаемое Snapshot. Сохранено для
+// совместимости и совпадает с KeyInfo.
+type PairSnapshot = KeyInfo
+
+// PairInfo описывает действующий ключ, возвращаемый Inspect, вместе с оставшимся временем жизни.
+type PairInfo struct {
+	KeyInfo
+	Remaining time.Duration // оставшееся время жизни ключа
+}
+
+// info возвращает описание записи о ключе с ключом key в виде для вывода.
+func (kInfo StoreRecord) info(key string) KeyInfo {
+	return KeyInfo{
+		DeviceID:  kInfo.DeviceID,
+		Key:       key,
+		IssuedAt:  kInfo.Time,
+		ExpiresAt: kInfo.Expires,
+	}
+}
+
+// Inspect возвращает информацию о действующем ключе, не удаляя запись о нем. Все значения
+// определяются под одной блокировкой, поэтому, в отличии от отдельных вызовов Peek и TTL,
+// согласованы между собой. Если ключ не найден или уже просрочен, то возвращается false.
+func (p *Pairs) Inspect(key string) (info PairInfo, ok bool) {
+	key = p.canonical(key)
+	if p.checkKey(key) != nil {
+		return info, false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	kInfo, found := p.get(p.storeKey(key))
+	if !found || p.expired(kInfo) {
+		return info, false
+	}
+	return PairInfo{KeyInfo: kInfo.info(p.format(key)), Remaining: p.ttl(kInfo)}, true
+}
+
+// Snapshot возвращает копию информации обо всех действующих ключах на текущий момент. Копия
+// создается под блокировкой, поэтому она согласована. Порядок элементов не определен.
+//
+// Если задана опция WithSnapshotMask, то ключи в копии маскируются.
+func (p *Pairs) Snapshot() []KeyInfo {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var snapshot []KeyInfo
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if !p.expired(kInfo) {
+			snapshot = append(snapshot, kInfo.info(p.formatStored(p.maskKey(p.unscoped(kInfo.Key)))))
+		}
+		return true
+	})
+	return snapshot
+}
+
+// RangeInfo вызывает f для каждого действующего ключа, передавая его описание. Устаревшие ключи
+// пропускаются. Перебор прекращается, если f возвращает false. Порядок перебора не определен. В
+// отличии от Snapshot ключи не маскируются и не копируются все сразу.
+//
+// Функция f вызывается под блокировкой, поэтому внутри нее нельзя обращаться к методам Pairs.
+func (p *Pairs) RangeInfo(f func(info KeyInfo) bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if p.expired(kInfo) {
+			return true
+		}
+		return f(kInfo.info(p.formatStored(kInfo.Key)))
+	})
+}
+
+// MaskKey возвращает ключ, в котором все символы, кроме первого и последнего, заменены на
+// звездочки, например, "A****3". Предназначена для вывода ключей в журналы, чтобы действующие
+// ключи не попадали в них целиком. Ключи из одного или двух символов маскируются полностью.
+func MaskKey(key string) string {
+	runes := []rune(key)
+	if len(runes) <= 2 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-2) + string(runes[len(runes)-1])
+}
+
+// maskKey заменяет символы ключа после первых видимых на '*', если маскирование задано.
+func (p *Pairs) maskKey(key string) string {
+	if !p.mask {
+		return key
+	}
+	runes := []rune(key)
+	if p.maskVisible >= len(runes) {
+		return key
+	}
+	return string(runes[:p.maskVisible]) + strings.Repeat("*", len(runes)-p.maskVisible)
+}
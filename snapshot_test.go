@@ -0,0 +1,105 @@
+package pairing
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute))
+	key := p.Generate("device")
+	p.GenerateWithExpire("expired", time.Second)
+	clock.Advance(time.Second)
+	snapshot := p.Snapshot()
+	want := PairSnapshot{DeviceID: "device", Key: key, IssuedAt: clock.now.Add(-time.Second),
+		ExpiresAt: clock.now.Add(59 * time.Second)}
+	if len(snapshot) != 1 || snapshot[0] != want {
+		t.Fatalf("unexpected snapshot: %+v", snapshot)
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"device_id":"device"`) {
+		t.Errorf("unexpected json: %s", data)
+	}
+}
+
+func TestSnapshotMask(t *testing.T) {
+	p := mustNew(t, WithSnapshotMask(2), WithGrouping(3, "-"))
+	key := p.Generate("device")
+	snapshot := p.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Key != key[:2]+"*-***" {
+		t.Errorf("bad masked key %v for %q", snapshot, key)
+	}
+	if _, err := New(WithSnapshotMask(-1)); err == nil {
+		t.Error("negative mask accepted")
+	}
+}
+
+func TestInspect(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithGrouping(3, "-"))
+	key := p.Generate("device")
+	issued := clock.Now()
+	clock.Advance(20 * time.Second)
+	info, ok := p.Inspect(strings.ReplaceAll(key, "-", ""))
+	if !ok || info.DeviceID != "device" || info.Key != key || !info.IssuedAt.Equal(issued) ||
+		!info.ExpiresAt.Equal(issued.Add(time.Minute)) || info.Remaining != 40*time.Second {
+		t.Errorf("unexpected info: %+v %v", info, ok)
+	}
+	if _, ok := p.Peek(key); !ok {
+		t.Error("key consumed by Inspect")
+	}
+	clock.Advance(40 * time.Second)
+	if _, ok := p.Inspect(key); ok {
+		t.Error("expired key inspected")
+	}
+	if _, ok := p.Inspect("unknown"); ok {
+		t.Error("unknown key inspected")
+	}
+}
+
+func TestRangeInfo(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute), WithSnapshotMask(1))
+	key := p.Generate("device")
+	issued := clock.Now()
+	clock.Advance(time.Minute)
+	p.Generate("other")
+	var infos []KeyInfo
+	p.RangeInfo(func(info KeyInfo) bool {
+		infos = append(infos, info)
+		return true
+	})
+	if len(infos) != 1 || infos[0].DeviceID != "other" {
+		t.Fatalf("unexpected infos: %+v", infos)
+	}
+	// ключи не маскируются, а изменение описания не влияет на список
+	infos[0].ExpiresAt = issued
+	other, _ := p.KeyForDevice("other")
+	if info, ok := p.Inspect(other); !ok || info.KeyInfo.Key != other ||
+		!info.ExpiresAt.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("unexpected info: %+v %v", info, ok)
+	}
+	if _, ok := p.Inspect(key); ok {
+		t.Error("expired key inspected")
+	}
+}
+
+func TestMaskKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"ABC123": "A****3",
+		"АБВ":    "А*В",
+		"AB":     "**",
+		"A":      "*",
+		"":       "",
+	} {
+		if got := MaskKey(key); got != want {
+			t.Errorf("MaskKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
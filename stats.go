@@ -0,0 +1,85 @@
+package pairing
+
+import "sync/atomic"
+
+// Stats содержит накопленную статистику работы списка ключей.
+type Stats struct {
+	Generated     uint64 // количество сгенерированных ключей
+	Collisions    uint64 // количество повторных попыток из-за совпадения с действующим ключом
+	MaxCollisions uint64 // максимальное количество повторных попыток при генерации одного ключа
+	Consumed      uint64 // количество успешно использованных ключей
+	Expired       uint64 // количество ключей, удаленных из-за истечения времени жизни
+}
+
+// counters содержит атомарные счетчики статистики, которые можно изменять и читать без
+// блокировки списка.
+type counters struct {
+	generated     atomic.Uint64
+	collisions    atomic.Uint64
+	maxCollisions atomic.Uint64
+	consumed      atomic.Uint64
+	expired       atomic.Uint64
+}
+
+// reset обнуляет все счетчики.
+func (c *counters) reset() {
+	c.generated.Store(0)
+	c.collisions.Store(0)
+	c.maxCollisions.Store(0)
+	c.consumed.Store(0)
+	c.expired.Store(0)
+}
+
+// Stats возвращает накопленную статистику. Рост количества повторных попыток при генерации
+// говорит о том, что пространство ключей близко к исчерпанию и стоит увеличить длину ключа или
+// словарь.
+//
+// Счетчики атомарные и читаются без блокировки, поэтому сбор статистики не замедляет генерацию.
+// Каждый счетчик точен, но они читаются по очереди, а Consumed и часть Expired увеличиваются уже
+// после снятия блокировки, поэтому при одновременных изменениях счетчики могут быть не согласованы
+// между собой и с содержимым хранилища: например, только что использованный ключ может быть еще
+// не учтен в Consumed. Количество действующих ключей, согласованное с хранилищем, возвращает Len.
+func (p *Pairs) Stats() Stats {
+	return Stats{
+		Generated:     p.stats.generated.Load(),
+		Collisions:    p.stats.collisions.Load(),
+		MaxCollisions: p.stats.maxCollisions.Load(),
+		Consumed:      p.stats.consumed.Load(),
+		Expired:       p.stats.expired.Load(),
+	}
+}
+
+// memEntryOverhead задает примерный размер в байтах служебных данных хранилища в памяти для
+// одной записи без учета длины ключа и идентификатора устройства: структура с информацией о
+// ключе, элементы справочников ключей и устройств и справочник ключей устройства.
+const memEntryOverhead = 320
+
+// MemStats содержит количество записей в хранилище и примерный объем занимаемой ими памяти.
+type MemStats struct {
+	Live    int // количество действующих ключей
+	Expired int // количество устаревших, но еще не удаленных ключей
+	Bytes   int // примерный объем памяти, занимаемой записями хранилища в памяти, в байтах
+}
+
+// MemStats возвращает количество действующих и устаревших записей в хранилище и примерный объем
+// занимаемой ими памяти, вычисленные за один проход под блокировкой. Объем памяти оценивается
+// как сумма длин ключей и идентификаторов устройств и постоянного размера служебных данных для
+// каждой записи, поэтому может заметно отличаться от действительного, но годится для
+// отслеживания роста. Для хранилищ, заданных WithStore, объем памяти не оценивается и равен 0.
+func (p *Pairs) MemStats() (stats MemStats) {
+	p.mu.RLock()
+	_, inMemory := p.store.(*memStore)
+	p.rangeStore(func(kInfo StoreRecord) bool {
+		if p.expired(kInfo) {
+			stats.Expired++
+		} else {
+			stats.Live++
+		}
+		if inMemory {
+			stats.Bytes += memEntryOverhead + len(kInfo.Key) + len(kInfo.DeviceID)
+		}
+		return true
+	})
+	p.mu.RUnlock()
+	return
+}
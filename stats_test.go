@@ -0,0 +1,73 @@
+package pairing
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	p := mustNew(t, WithExpire(20*time.Millisecond))
+	p.GetDeviceID(p.Generate("consumed"))
+	key := p.Generate("expired")
+	p.Generate("purged")
+	time.Sleep(30 * time.Millisecond)
+	p.GetDeviceID(key)
+	p.purge()
+	stats := p.Stats()
+	if stats.Generated != 3 || stats.Consumed != 1 || stats.Expired != 2 {
+		t.Errorf("bad counters: %+v", stats)
+	}
+}
+
+func TestStatsCollisions(t *testing.T) {
+	// хранилище без Len отключает быструю проверку заполненности пространства ключей
+	p := mustNew(t, WithDictionary(DictNum), WithLength(1), WithMaxIter(1000),
+		WithStore(&wrapStore{newMemStore(0)}))
+	// одиннадцатый ключ получить нельзя, поэтому совпадения гарантированы
+	for i := 0; i < 11; i++ {
+		p.Generate(string(rune('a' + i)))
+	}
+	stats := p.Stats()
+	if stats.Generated != 10 || stats.Collisions < 1000 || stats.MaxCollisions != 1000 {
+		t.Errorf("bad stats: %+v", stats)
+	}
+}
+
+func TestStatsConcurrent(t *testing.T) {
+	p := mustNew(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.GetDeviceID(p.Generate(strconv.Itoa(i)))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		p.Stats() // чтение статистики не требует блокировки
+	}
+	<-done
+	if stats := p.Stats(); stats.Generated != 100 || stats.Consumed != 100 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestMemStats(t *testing.T) {
+	clock := newFakeClock()
+	p := mustNew(t, WithClock(clock.Now), WithExpire(time.Minute))
+	if stats := p.MemStats(); stats != (MemStats{}) {
+		t.Errorf("unexpected stats for empty list: %+v", stats)
+	}
+	p.Generate("expired")
+	clock.Advance(time.Minute)
+	p.Generate("live")
+	stats := p.MemStats()
+	if stats.Live != 1 || stats.Expired != 1 || stats.Bytes < 2*memEntryOverhead {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	q := mustNew(t, WithStore(wrapStore{newMemStore(0)}))
+	q.Generate("device")
+	if stats := q.MemStats(); stats.Live != 1 || stats.Bytes != 0 {
+		t.Errorf("unexpected stats for custom store: %+v", stats)
+	}
+}
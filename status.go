@@ -0,0 +1,31 @@
+package pairing
+
+// Status описывает состояние ключа, возвращаемое Lookup.
+type Status int
+
+// Возможные состояния ключа.
+const (
+	NotFound    Status = iota // ключ не найден
+	Valid                     // ключ действителен
+	Expired                   // время жизни ключа истекло
+	BadChecksum               // неверный контрольный символ ключа, заданного с WithChecksum
+	Redeemed                  // ключ недавно использован, смотри WithRedeemGrace
+)
+
+// String возвращает название состояния ключа.
+func (s Status) String() string {
+	switch s {
+	case NotFound:
+		return "not found"
+	case Valid:
+		return "valid"
+	case Expired:
+		return "expired"
+	case BadChecksum:
+		return "bad checksum"
+	case Redeemed:
+		return "redeemed"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,202 @@
+package pairing
+
+import "time"
+
+// StoreRecord содержит сохраняемую в хранилище информацию об устройстве и времени генерации
+// ключа. Ключ в записи хранится в нормализованном виде без разделителей групп, а с WithHashedKeys
+// или WithUniquenessScope — в виде хеша или вместе с идентификатором устройства, поэтому хранилище
+// должно использовать его только как непрозрачную строку.
+type StoreRecord struct {
+	DeviceID string    // уникальный идентификатор устройства
+	Key      string    // уникальный ключ
+	Time     time.Time // время генерации или последнего продления ключа
+	Expires  time.Time // время, после которого ключ становится недействительным
+	Uses     int       // оставшееся количество использований; 0 означает одноразовый ключ
+}
+
+// Store описывает хранилище информации о выданных ключах. По умолчанию используется хранилище в
+// памяти, но его можно заменить с помощью WithStore, например, на общее для нескольких
+// экземпляров сервиса.
+//
+// Все методы хранилища вызываются под блокировкой Pairs, поэтому хранилище, используемое только
+// одним Pairs, может не заботиться о синхронизации. Методы GetByKey, GetByDevice и Range могут
+// вызываться одновременно под блокировкой на чтение, поэтому они не должны изменять хранилище.
+// Проверку времени жизни ключей по времени Expires в записи выполняет Pairs, но хранилище может
+// использовать это время и для удаления устаревших записей своими средствами.
+type Store interface {
+	// Put сохраняет запись о ключе устройства. Предыдущие записи для этого устройства и этого
+	// ключа при этом заменяются. Хранилище, общее для нескольких Pairs, должно атомарно проверять,
+	// что ключ не выдан другому устройству, и, если его запись еще действует, возвращать
+	// ErrKeyInUse: Pairs в этом случае считает ключ совпавшим и генерирует другой.
+	Put(kInfo StoreRecord) error
+	// GetByKey возвращает запись по ключу.
+	GetByKey(key string) (kInfo StoreRecord, ok bool)
+	// GetByDevice возвращает запись по идентификатору устройства.
+	GetByDevice(deviceID string) (kInfo StoreRecord, ok bool)
+	// DeleteByKey удаляет запись по ключу и возвращает true, если она была найдена. Для
+	// хранилища, общего для нескольких Pairs, true должен получить только один из одновременных
+	// вызовов: по нему определяется, кто использовал ключ.
+	DeleteByKey(key string) bool
+	// DeleteByDevice удаляет запись по идентификатору устройства и возвращает true, если она
+	// была найдена.
+	DeleteByDevice(deviceID string) bool
+	// Range вызывает f для каждой записи хранилища, пока f возвращает true. Изменять хранилище
+	// внутри f нельзя.
+	Range(f func(kInfo StoreRecord) bool)
+}
+
+// Хранилище может дополнительно реализовать метод Len() int, возвращающий количество записей,
+// включая устаревшие. В этом случае Pairs использует его для быстрой проверки заполненности
+// пространства ключей.
+//
+// Хранилище, общее для нескольких Pairs, может также реализовать метод
+// Take(key string) (StoreRecord, bool), атомарно удаляющий запись по ключу и возвращающий ее. Тогда
+// при использовании ключа счетчик многоразового ключа уменьшается по действительно удаленной
+// записи, а не по прочитанной ранее, которую мог уже изменить другой экземпляр.
+//
+// Хранилище, обращение к которому может завершиться ошибкой, может также реализовать методы
+// LookupKey(key string) (StoreRecord, bool, error) и
+// LookupDevice(deviceID string) (StoreRecord, bool, error), работающие так же, как GetByKey и
+// GetByDevice, но возвращающие ошибку хранилища. Тогда при генерации и назначении ключа ошибка
+// возвращается вызывающему, а не принимается за отсутствие записи, т.е. за свободный ключ.
+
+// multiKeyStore описывает хранилище, поддерживающее несколько ключей для одного устройства,
+// которое необходимо для WithMultiKey. Для такого хранилища DeleteByDevice удаляет все записи
+// устройства, а GetByDevice возвращает последнюю выданную.
+type multiKeyStore interface {
+	Store
+	// Add сохраняет запись о ключе устройства, не заменяя другие записи этого устройства.
+	// Предыдущая запись для этого ключа при этом заменяется.
+	Add(kInfo StoreRecord) error
+	// ByDevice возвращает все записи устройства.
+	ByDevice(deviceID string) []StoreRecord
+}
+
+// memStore описывает хранилище ключей в памяти, используемое по умолчанию. Оно поддерживает
+// несколько ключей для одного устройства.
+type memStore struct {
+	devices map[string]map[string]*StoreRecord // справочник ключей для устройств
+	keys    map[string]*StoreRecord            // справочник устройств по сгенерированным ключам
+	peak    int                                // наибольшее число записей с создания справочников
+}
+
+// newMemStore возвращает новое хранилище в памяти, рассчитанное на size одновременных ключей.
+func newMemStore(size int) *memStore {
+	return &memStore{
+		devices: make(map[string]map[string]*StoreRecord, size),
+		keys:    make(map[string]*StoreRecord, size),
+	}
+}
+
+func (s *memStore) Len() int { return len(s.keys) }
+
+func (s *memStore) Put(kInfo StoreRecord) error {
+	s.DeleteByDevice(kInfo.DeviceID)
+	return s.Add(kInfo)
+}
+
+func (s *memStore) Add(kInfo StoreRecord) error {
+	s.DeleteByKey(kInfo.Key)
+	keys := s.devices[kInfo.DeviceID]
+	if keys == nil {
+		keys = make(map[string]*StoreRecord, 1)
+		s.devices[kInfo.DeviceID] = keys
+	}
+	keys[kInfo.Key] = &kInfo
+	s.keys[kInfo.Key] = &kInfo
+	if len(s.keys) > s.peak {
+		s.peak = len(s.keys)
+	}
+	return nil
+}
+
+func (s *memStore) GetByKey(key string) (StoreRecord, bool) {
+	if kInfo, ok := s.keys[key]; ok {
+		return *kInfo, true
+	}
+	return StoreRecord{}, false
+}
+
+func (s *memStore) GetByDevice(deviceID string) (StoreRecord, bool) {
+	var last *StoreRecord
+	for _, kInfo := range s.devices[deviceID] {
+		if last == nil || kInfo.Time.After(last.Time) {
+			last = kInfo
+		}
+	}
+	if last == nil {
+		return StoreRecord{}, false
+	}
+	return *last, true
+}
+
+func (s *memStore) ByDevice(deviceID string) []StoreRecord {
+	keys := s.devices[deviceID]
+	if len(keys) == 0 {
+		return nil
+	}
+	list := make([]StoreRecord, 0, len(keys))
+	for _, kInfo := range keys {
+		list = append(list, *kInfo)
+	}
+	return list
+}
+
+func (s *memStore) DeleteByKey(key string) bool {
+	kInfo, ok := s.keys[key]
+	if ok {
+		delete(s.keys, key)
+		keys := s.devices[kInfo.DeviceID]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(s.devices, kInfo.DeviceID)
+		}
+	}
+	return ok
+}
+
+func (s *memStore) Take(key string) (StoreRecord, bool) {
+	kInfo, ok := s.GetByKey(key)
+	return kInfo, ok && s.DeleteByKey(key)
+}
+
+func (s *memStore) DeleteByDevice(deviceID string) bool {
+	keys, ok := s.devices[deviceID]
+	for key := range keys {
+		delete(s.keys, key)
+	}
+	delete(s.devices, deviceID)
+	return ok
+}
+
+func (s *memStore) Range(f func(kInfo StoreRecord) bool) {
+	for _, kInfo := range s.keys {
+		if !f(*kInfo) {
+			return
+		}
+	}
+}
+
+// sparse возвращает true, если количество записей относительно наибольшего с момента создания
+// справочников меньше ratio. Справочники Go не уменьшаются при удалении записей, поэтому в этом
+// случае большая часть занятой ими памяти не используется.
+func (s *memStore) sparse(ratio float64) bool {
+	return s.peak > 0 && float64(len(s.keys)) < ratio*float64(s.peak)
+}
+
+// compact возвращает копию хранилища в новых справочниках, размер которых рассчитан на текущее
+// количество записей.
+func (s *memStore) compact() *memStore {
+	c := newMemStore(len(s.keys))
+	for key, kInfo := range s.keys {
+		keys := c.devices[kInfo.DeviceID]
+		if keys == nil {
+			keys = make(map[string]*StoreRecord, len(s.devices[kInfo.DeviceID]))
+			c.devices[kInfo.DeviceID] = keys
+		}
+		keys[key] = kInfo
+		c.keys[key] = kInfo
+	}
+	c.peak = len(c.keys)
+	return c
+}
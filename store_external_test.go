@@ -0,0 +1,88 @@
+package pairing_test
+
+import (
+	"testing"
+
+	"github.com/geotrace/pairing"
+)
+
+// mapStore реализует pairing.Store вне пакета на простых справочниках.
+type mapStore struct {
+	keys    map[string]pairing.StoreRecord // записи по ключам
+	devices map[string]string              // ключи по идентификаторам устройств
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{keys: make(map[string]pairing.StoreRecord), devices: make(map[string]string)}
+}
+
+func (s *mapStore) Put(rec pairing.StoreRecord) error {
+	s.DeleteByDevice(rec.DeviceID)
+	s.DeleteByKey(rec.Key)
+	s.keys[rec.Key] = rec
+	s.devices[rec.DeviceID] = rec.Key
+	return nil
+}
+
+func (s *mapStore) GetByKey(key string) (pairing.StoreRecord, bool) {
+	rec, ok := s.keys[key]
+	return rec, ok
+}
+
+func (s *mapStore) GetByDevice(deviceID string) (pairing.StoreRecord, bool) {
+	key, ok := s.devices[deviceID]
+	if !ok {
+		return pairing.StoreRecord{}, false
+	}
+	return s.GetByKey(key)
+}
+
+func (s *mapStore) DeleteByKey(key string) bool {
+	rec, ok := s.keys[key]
+	if ok {
+		delete(s.keys, key)
+		if s.devices[rec.DeviceID] == key {
+			delete(s.devices, rec.DeviceID)
+		}
+	}
+	return ok
+}
+
+func (s *mapStore) DeleteByDevice(deviceID string) bool {
+	key, ok := s.devices[deviceID]
+	if ok {
+		delete(s.devices, deviceID)
+		delete(s.keys, key)
+	}
+	return ok
+}
+
+func (s *mapStore) Range(f func(rec pairing.StoreRecord) bool) {
+	for _, rec := range s.keys {
+		if !f(rec) {
+			return
+		}
+	}
+}
+
+func TestExternalStore(t *testing.T) {
+	store := newMapStore()
+	p, err := pairing.New(pairing.WithStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := p.Generate("device")
+	key := p.Generate("device")
+	if len(store.keys) != 1 {
+		t.Errorf("old key not replaced: %v", store.keys)
+	}
+	if id := p.GetDeviceID(old); id != "" {
+		t.Errorf("old key consumed by %q", id)
+	}
+	if id := p.GetDeviceID(key); id != "device" {
+		t.Errorf("key not found: %q", id)
+	}
+	if len(store.keys) != 0 || len(store.devices) != 0 {
+		t.Errorf("used key not deleted: %v %v", store.keys, store.devices)
+	}
+}
@@ -0,0 +1,180 @@
+package pairing
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemStore(t *testing.T) {
+	s := newMemStore(0)
+	s.Put(StoreRecord{DeviceID: "a", Key: "1"})
+	s.Put(StoreRecord{DeviceID: "b", Key: "2"})
+	// повторная запись для устройства заменяет его старый ключ
+	s.Put(StoreRecord{DeviceID: "a", Key: "3"})
+	if _, ok := s.GetByKey("1"); ok {
+		t.Error("old key not replaced")
+	}
+	if kInfo, ok := s.GetByDevice("a"); !ok || kInfo.Key != "3" {
+		t.Errorf("bad record: %v %v", kInfo, ok)
+	}
+	// запись того же ключа для другого устройства отвязывает его от прежнего
+	s.Put(StoreRecord{DeviceID: "c", Key: "2"})
+	if _, ok := s.GetByDevice("b"); ok {
+		t.Error("old device not replaced")
+	}
+	if !s.DeleteByKey("3") || s.DeleteByDevice("a") {
+		t.Error("bad delete by key")
+	}
+	if !s.DeleteByDevice("c") || s.DeleteByKey("2") {
+		t.Error("bad delete by device")
+	}
+	var count int
+	s.Range(func(StoreRecord) bool { count++; return true })
+	if count != 0 {
+		t.Errorf("store not empty: %d", count)
+	}
+}
+
+func TestWithStore(t *testing.T) {
+	s := newMemStore(0)
+	p := mustNew(t, WithStore(s))
+	key := p.Generate("device")
+	if kInfo, ok := s.GetByKey(key); !ok || kInfo.DeviceID != "device" {
+		t.Errorf("key not stored: %v %v", kInfo, ok)
+	}
+}
+
+// sharedStore описывает хранилище в памяти, которое можно использовать из нескольких Pairs. Чтение
+// записи по ключу задерживается, как в медленном внешнем хранилище.
+type sharedStore struct {
+	mu    sync.Mutex
+	s     *memStore
+	delay time.Duration
+}
+
+func (s *sharedStore) Put(kInfo StoreRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.Put(kInfo)
+}
+
+func (s *sharedStore) GetByKey(key string) (StoreRecord, bool) {
+	s.mu.Lock()
+	kInfo, ok := s.s.GetByKey(key)
+	s.mu.Unlock()
+	time.Sleep(s.delay) // прочитанная запись может устареть до возврата
+	return kInfo, ok
+}
+
+func (s *sharedStore) GetByDevice(deviceID string) (StoreRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.GetByDevice(deviceID)
+}
+
+func (s *sharedStore) DeleteByKey(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.DeleteByKey(key)
+}
+
+func (s *sharedStore) Take(key string) (StoreRecord, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.Take(key)
+}
+
+func (s *sharedStore) DeleteByDevice(deviceID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.s.DeleteByDevice(deviceID)
+}
+
+func (s *sharedStore) Range(f func(kInfo StoreRecord) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.s.Range(f)
+}
+
+func TestSharedStoreLookup(t *testing.T) {
+	store := &sharedStore{s: newMemStore(0), delay: time.Millisecond}
+	a := mustNew(t, WithStore(store))
+	b := mustNew(t, WithStore(store))
+	for i := 0; i < 20; i++ {
+		var (
+			key   = a.Generate("device")
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			valid int
+		)
+		if i%2 == 1 {
+			key = a.GenerateMultiUse("device", 2) // оба использования должны пройти по одному разу
+		}
+		for _, p := range []*Pairs{a, b, a, b} {
+			wg.Add(1)
+			go func(p *Pairs) {
+				defer wg.Done()
+				if _, status := p.Lookup(key); status == Valid {
+					mu.Lock()
+					valid++
+					mu.Unlock()
+				}
+			}(p)
+		}
+		wg.Wait()
+		if want := 1 + i%2; valid > want {
+			t.Fatalf("key used %d times, want at most %d", valid, want)
+		}
+	}
+}
+
+// racyStore отвечает на Put ошибкой ErrKeyInUse заданное количество раз, как общее хранилище,
+// в которое тот же ключ успел записать другой экземпляр, и может возвращать ошибку чтения.
+type racyStore struct {
+	Store
+	conflicts int   // количество оставшихся отказов Put
+	readErr   error // ошибка LookupKey и LookupDevice
+}
+
+func (s *racyStore) Put(kInfo StoreRecord) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		return ErrKeyInUse
+	}
+	return s.Store.Put(kInfo)
+}
+
+func (s *racyStore) LookupKey(key string) (StoreRecord, bool, error) {
+	kInfo, ok := s.GetByKey(key)
+	return kInfo, ok, s.readErr
+}
+
+func (s *racyStore) LookupDevice(deviceID string) (StoreRecord, bool, error) {
+	kInfo, ok := s.GetByDevice(deviceID)
+	return kInfo, ok, s.readErr
+}
+
+func TestStoreConflict(t *testing.T) {
+	store := &racyStore{Store: newMemStore(0), conflicts: 1}
+	p := mustNew(t, WithStore(store))
+	key, err := p.GenerateE("device")
+	if err != nil || p.GetDeviceID(key) != "device" {
+		t.Fatalf("key not generated after conflict: %q %v", key, err)
+	}
+	if s := p.Stats(); s.Collisions != 1 {
+		t.Errorf("conflict not counted as collision: %d", s.Collisions)
+	}
+	store.readErr = errors.New("store unavailable")
+	if key, err := p.GenerateE("device"); err == nil {
+		t.Errorf("key generated despite read error: %q", key)
+	}
+	if err := p.Assign("device", "KEY"); err == nil {
+		t.Error("key assigned despite read error")
+	}
+	store.readErr, store.conflicts = nil, 1
+	if err := p.Assign("device", "KEY"); err != ErrKeyInUse {
+		t.Errorf("unexpected assign error: %v", err)
+	}
+}
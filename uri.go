@@ -0,0 +1,27 @@
+package pairing
+
+import (
+	"errors"
+	"net/url"
+)
+
+// GenerateURI генерирует новый ключ для устройства и возвращает ссылку для спаривания вида
+// baseURL?code=<ключ>, пригодную для кодирования в QR-код. Базовый адрес должен быть абсолютным;
+// параметры запроса, уже указанные в нем, сохраняются.
+func (p *Pairs) GenerateURI(deviceID, baseURL string) (string, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return "", errors.New("pairing: базовый адрес ссылки должен быть абсолютным")
+	}
+	key, err := p.GenerateE(deviceID)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("code", key)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,29 @@
+package pairing
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestGenerateURI(t *testing.T) {
+	p := mustNew(t, WithDictionary("AB+&"))
+	link, err := p.GenerateURI("device", "https://example.com/pair?app=tv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Host != "example.com" || u.Path != "/pair" || u.Query().Get("app") != "tv" {
+		t.Errorf("bad link: %q", link)
+	}
+	if id, ok := p.Peek(u.Query().Get("code")); !ok || id != "device" {
+		t.Errorf("bad code in link %q: %q %v", link, id, ok)
+	}
+	for _, base := range []string{"/pair", "example.com", "http://%zz"} {
+		if _, err := p.GenerateURI("device", base); err == nil {
+			t.Errorf("bad base %q accepted", base)
+		}
+	}
+}
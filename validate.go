@@ -0,0 +1,94 @@
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Validate проверяет параметры генерации ключей: словарь, разделитель групп символов, символы,
+// удаляемые из введенных ключей, длину ключа и размер пространства ключей. Пространство ключей не
+// должно быть меньше MaxActive, а его неопределенность — меньше заданной WithMinEntropy. Не
+// заданные параметры проверяются со значениями по умолчанию. New вызывает эту проверку
+// автоматически.
+func (p *Pairs) Validate() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	dict, length := p.Dictionary, p.Length
+	if len(dict) == 0 {
+		dict = DictAlfa
+	}
+	if length == 0 {
+		length = defaultLength
+	}
+	if err := dict.Validate(); err != nil {
+		return err
+	}
+	if p.Expire < 0 {
+		return errors.New("pairing: время жизни ключа не может быть отрицательным")
+	}
+	if err := p.checkLength(length); err != nil {
+		return err
+	}
+	if err := p.checkLength(p.autoWiden); err != nil {
+		return err
+	}
+	if p.autoWiden != 0 && p.autoWiden < length {
+		return fmt.Errorf("pairing: максимальная длина ключа %d меньше длины %d", p.autoWiden, length)
+	}
+	if p.groupSep != "" && strings.ContainsAny(p.groupSep, string(dict)) {
+		return errors.New("pairing: разделитель групп содержит символы словаря")
+	}
+	if p.prefix != "" && (strings.TrimSpace(p.prefix) != p.prefix ||
+		p.groupSep != "" && strings.Contains(p.prefix, p.groupSep) ||
+		strings.ContainsAny(p.prefix, p.stripChars)) {
+		return errors.New("pairing: префикс ключа изменяется при нормализации")
+	}
+	strip := p.stripChars
+	if p.caseless {
+		strip = strings.ToUpper(strip) // строчные буквы тоже считаются символами словаря
+	}
+	if strings.ContainsAny(strip, string(dict)) {
+		return errors.New("pairing: удаляемые из ключа символы содержат символы словаря")
+	}
+	if p.minDistinct > int(length) || p.segments == nil && p.minDistinct > dict.Len() {
+		return fmt.Errorf("pairing: ключ длиной %d из словаря в %d символов не может содержать %d "+
+			"разных символов", length, dict.Len(), p.minDistinct)
+	}
+	if p.perDevice && (strings.ContainsAny(string(dict), scopeSep) ||
+		strings.Contains(p.prefix, scopeSep)) {
+		return errors.New("pairing: словарь или префикс содержат нулевой символ")
+	}
+	if p.outputCase != CaseAsIs && !p.caseless {
+		return errors.New("pairing: изменение регистра выдаваемых ключей требует WithCaseInsensitive")
+	}
+	if p.noRotate && (p.reuse || p.cooldown > 0) {
+		return errors.New("pairing: запрет замены действующего ключа не совместим с его повторной выдачей")
+	}
+	if p.hashed && p.collisionKey != nil {
+		return errors.New("pairing: хеши ключей нельзя сравнивать функцией проверки уникальности")
+	}
+	if p.hashed && (p.reuse || p.cooldown > 0) {
+		return errors.New("pairing: хеши ключей не позволяют повторно вернуть выданный ключ")
+	}
+	if _, ok := p.store.(multiKeyStore); p.multi && p.store != nil && !ok {
+		return errors.New("pairing: хранилище не поддерживает несколько ключей для устройства")
+	}
+	if p.caseless {
+		if err := dict.validateCaseless(); err != nil {
+			return err
+		}
+	}
+	size := p.keySpaceOf(dict, length) // для части разделенного списка пространство меньше
+	// при уникальности в пределах устройства пространство ключей у каждого устройства свое
+	if p.MaxActive > 0 && !p.perDevice && size < float64(p.MaxActive) {
+		return fmt.Errorf("pairing: размер пространства ключей %.0f меньше MaxActive %d",
+			size, p.MaxActive)
+	}
+	if bits := math.Log2(size); bits < p.minEntropy {
+		return fmt.Errorf("pairing: неопределенность ключа %.1f бит (пространство ключей %.0f) "+
+			"меньше минимальной %.1f бит", bits, size, p.minEntropy)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package pairing
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	if err := new(Pairs).Validate(); err != nil {
+		t.Errorf("defaults rejected: %v", err)
+	}
+	_, err := New(WithDictionary(DictNum), WithLength(1), WithMaxActive(20))
+	if err == nil || !strings.Contains(err.Error(), " 10 ") {
+		t.Errorf("small key space accepted: %v", err)
+	}
+	if _, err := New(WithDictionary(DictNum), WithLength(4), WithMinEntropy(20)); err == nil {
+		t.Error("low entropy accepted")
+	}
+	if _, err := New(WithDictionary(DictNum), WithLength(8), WithMinEntropy(20)); err != nil {
+		t.Error(err)
+	}
+	// у части разделенного списка первый символ выбирается из подмножества словаря
+	_, err = NewSharded(WithDictionary(DictNum), WithLength(6), WithMinEntropy(19), WithShards(10))
+	if err == nil {
+		t.Error("low sharded entropy accepted")
+	}
+	p := &Pairs{Dictionary: "AAB"}
+	if err := p.Validate(); err == nil {
+		t.Error("duplicate characters accepted")
+	}
+	if _, err := New(WithExpire(-time.Minute)); err == nil {
+		t.Error("negative expire accepted")
+	}
+}